@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores the query results of tables, the key is built from the sql and vars of query
+//  all the results of a table are invalidated when the table is written
+type Cache interface {
+	Get(table, key string) (value interface{}, ok bool)
+	Set(table, key string, value interface{})
+	Invalidate(table string)
+}
+
+// LRU is an in-memory Cache, it evicts the least recently used results when it is full, and the results expire
+// after ttl, it is safe for concurrent use
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List                          // the front is the most recently used
+	items    map[string]map[string]*list.Element // table -> key -> element of *entry
+}
+
+type entry struct {
+	table     string
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+var _ Cache = (*LRU)(nil)
+
+// NewLRU returns a LRU cache holding at most capacity results, zero ttl means the results never expire
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	return &LRU{capacity: capacity, ttl: ttl, ll: list.New(), items: make(map[string]map[string]*list.Element)}
+}
+
+func (c *LRU) Get(table, key string) (value interface{}, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[table][key]
+	if !ok {
+		return
+	}
+	e := elem.Value.(*entry)
+	if c.ttl > 0 && time.Now().After(e.expiresAt) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return e.value, true
+}
+
+func (c *LRU) Set(table, key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[table][key]; ok {
+		c.remove(elem)
+	}
+	e := &entry{table: table, key: key, value: value, expiresAt: time.Now().Add(c.ttl)}
+	if c.items[table] == nil {
+		c.items[table] = make(map[string]*list.Element)
+	}
+	c.items[table][key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.capacity {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *LRU) Invalidate(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, elem := range c.items[table] {
+		c.ll.Remove(elem)
+	}
+	delete(c.items, table)
+}
+
+// Len returns the number of cached results
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// remove removes the element from cache, it must be called with lock held
+func (c *LRU) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.ll.Remove(elem)
+	delete(c.items[e.table], e.key)
+	if len(c.items[e.table]) == 0 {
+		delete(c.items, e.table)
+	}
+}
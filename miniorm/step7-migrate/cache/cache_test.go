@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2, 0)
+	c.Set("User", "a", 1)
+	c.Set("User", "b", 2)
+	if v, ok := c.Get("User", "a"); !ok || v != 1 {
+		t.Fatalf("failed to get cached value, got %v", v)
+	}
+	// "b" is the least recently used one
+	c.Set("Book", "c", 3)
+	if _, ok := c.Get("User", "b"); ok || c.Len() != 2 {
+		t.Fatal("failed to evict the least recently used value")
+	}
+
+	c.Invalidate("User")
+	if _, ok := c.Get("User", "a"); ok || c.Len() != 1 {
+		t.Fatal("failed to invalidate the values of table User")
+	}
+	if v, ok := c.Get("Book", "c"); !ok || v != 3 {
+		t.Fatal("the values of other tables should not be invalidated")
+	}
+}
+
+func TestLRU_TTL(t *testing.T) {
+	c := NewLRU(10, 10*time.Millisecond)
+	c.Set("User", "a", 1)
+	if _, ok := c.Get("User", "a"); !ok {
+		t.Fatal("failed to get cached value")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("User", "a"); ok || c.Len() != 0 {
+		t.Fatal("the value should expire")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"strings"
 )
 
+// Clause keeps the sql clauses of a statement, it is copied on write: Set never changes the maps shared with the
+// copies of Clause, so a copy can be changed without affecting the original one
 type Clause struct {
 	sql     map[ClauseType]string
 	sqlVars map[ClauseType][]interface{}
@@ -28,13 +30,44 @@ const (
 //  param vars[0] string, table name
 //  param vars[1:] []string, columns(included column constraints) of table
 func (c *Clause) Set(name ClauseType, vars ...interface{}) {
-	if c.sql == nil {
-		c.sql = make(map[ClauseType]string)
-		c.sqlVars = make(map[ClauseType][]interface{})
+	sqlClauses := make(map[ClauseType]string, len(c.sql)+1)
+	sqlVars := make(map[ClauseType][]interface{}, len(c.sqlVars)+1)
+	for k, v := range c.sql {
+		sqlClauses[k] = v
+	}
+	for k, v := range c.sqlVars {
+		sqlVars[k] = v
 	}
 	sqlClause, vars := generators[name](vars...)
-	c.sql[name] = sqlClause
-	c.sqlVars[name] = vars
+	sqlClauses[name] = sqlClause
+	sqlVars[name] = vars
+	c.sql, c.sqlVars = sqlClauses, sqlVars
+}
+
+// Remove removes the sql clause of the given clause type, like Set, it never changes the maps shared with the copies
+func (c *Clause) Remove(name ClauseType) {
+	if _, ok := c.sql[name]; !ok {
+		return
+	}
+	sqlClauses := make(map[ClauseType]string, len(c.sql))
+	sqlVars := make(map[ClauseType][]interface{}, len(c.sqlVars))
+	for k, v := range c.sql {
+		if k != name {
+			sqlClauses[k] = v
+		}
+	}
+	for k, v := range c.sqlVars {
+		if k != name {
+			sqlVars[k] = v
+		}
+	}
+	c.sql, c.sqlVars = sqlClauses, sqlVars
+}
+
+// Get returns the sql clause and vars of the given clause type, ok is false if it is not set
+func (c *Clause) Get(name ClauseType) (sqlClause string, vars []interface{}, ok bool) {
+	sqlClause, ok = c.sql[name]
+	return sqlClause, c.sqlVars[name], ok
 }
 
 // Build generate the complete sql based the given clause order
@@ -29,3 +29,25 @@ func TestClause_Build(t *testing.T) {
 	clause.Set(INSERT, "User")
 
 }
+
+func TestClause_CopyOnWrite(t *testing.T) {
+	var base Clause
+	base.Set(WHERE, "Age > ?", 10)
+	c := base
+	c.Set(WHERE, "Age > ?", 20)
+	c.Set(LIMIT, 0, 1)
+	if sqlClause, vars := base.Build(WHERE, LIMIT); sqlClause != "WHERE Age > ?" || vars[0] != 10 {
+		t.Fatalf("the copy of clause should not change the original one, sql: %s, vars: %v", sqlClause, vars)
+	}
+	if sqlClause, vars := c.Build(WHERE, LIMIT); sqlClause != "WHERE Age > ? LIMIT ?, ?" || vars[0] != 20 {
+		t.Fatalf("failed to set the copy of clause, sql: %s, vars: %v", sqlClause, vars)
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	orders := ParseOrderBy(" -age, +name,,Id ")
+	expected := []OrderBy{{Column: "age", Desc: true}, {Column: "name"}, {Column: "Id"}}
+	if !reflect.DeepEqual(orders, expected) {
+		t.Fatalf("failed to parse order by, expected %v, but got %v", expected, orders)
+	}
+}
@@ -0,0 +1,32 @@
+package clause
+
+import (
+	"strings"
+)
+
+// OrderBy is a column of ORDER BY clause, the Column is checked against the columns of model before it is used
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+// ParseOrderBy parses the sort string like "-Age,Name" to ORDER BY columns, the prefix '-' means DESC and the
+// prefix '+' or no prefix means ASC, it is usually the sort parameter of http request
+//  the columns are not checked here, pass them to Session.OrderBy to check them against the model
+func ParseOrderBy(sort string) (orders []OrderBy) {
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		order := OrderBy{Column: part}
+		switch part[0] {
+		case '-':
+			order.Column, order.Desc = strings.TrimSpace(part[1:]), true
+		case '+':
+			order.Column = strings.TrimSpace(part[1:])
+		}
+		orders = append(orders, order)
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+
+	"miniorm"
+	"miniorm/dialect"
+	"miniorm/schema"
+)
+
+// Generator generates the Go structs with miniorm tags from the tables in database
+type Generator struct {
+	Package string
+	Tables  []string // the tables to generate, all tables if empty
+	Naming  schema.NamingStrategy
+}
+
+type structField struct {
+	name   string
+	goType string
+	tag    string
+}
+
+// Generate reads the tables by migrator and returns the gofmt-ed source of structs
+//  the table with composite primary key is rejected, because the primary key is declared by the column tag
+func (g *Generator) Generate(m *miniorm.Migrator) (src []byte, err error) {
+	tables := g.Tables
+	if len(tables) == 0 {
+		if tables, err = m.ListTables(); err != nil {
+			return
+		}
+		sort.Strings(tables)
+	}
+
+	var body bytes.Buffer
+	importTime := false
+	for _, table := range tables {
+		var columns []dialect.ColumnType
+		var indexes []dialect.Index
+		if columns, err = m.ColumnTypes(table); err != nil {
+			return
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("table %s NOT FOUND", table)
+		}
+		// the primary key tag is column-level, the composite one would declare more than one primary key
+		if pks := primaryKeys(columns); len(pks) > 1 {
+			return nil, fmt.Errorf("table %s has the composite primary key (%s) which can not be declared by miniorm tags, "+
+				"leave it out of Tables", table, strings.Join(pks, ", "))
+		}
+		if indexes, err = m.Indexes(table); err != nil {
+			return
+		}
+		fields := g.fields(table, columns, indexes)
+		for _, f := range fields {
+			importTime = importTime || strings.Contains(f.goType, "time.Time")
+		}
+		g.writeStruct(&body, table, fields)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by miniorm-gen. DO NOT EDIT.\n\npackage %s\n\n", g.Package)
+	if importTime {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+func (g *Generator) writeStruct(buf *bytes.Buffer, table string, fields []structField) {
+	name := g.Naming.StructName(table)
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	for _, f := range fields {
+		fmt.Fprintf(buf, "\t%s %s", f.name, f.goType)
+		if f.tag != "" {
+			fmt.Fprintf(buf, " %s", f.tag)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n\n")
+	// the table name can't be mapped back from struct name by naming strategy
+	if g.Naming.TableName(name) != table {
+		fmt.Fprintf(buf, "func (%s) TableName() string {\n\treturn %s\n}\n\n", name, strconv.Quote(table))
+	}
+}
+
+// fields converts the columns to struct fields, the constraints and indexes are kept in tags
+func (g *Generator) fields(table string, columns []dialect.ColumnType, indexes []dialect.Index) (fields []structField) {
+	uniques := make(map[string]bool)
+	settings := make(map[string][]string) // column -> index settings
+	for _, idx := range indexes {
+		if idx.Implicit {
+			if idx.Unique && len(idx.Columns) == 1 {
+				uniques[idx.Columns[0]] = true
+				continue
+			}
+			if !idx.Unique || isPrimaryKey(columns, idx.Columns) {
+				continue
+			}
+			// the name of implicit index is reserved by database, give a new one to the composite unique key
+			idx.Name = fmt.Sprintf("uk_%s_%s", table, strings.Join(idx.Columns, "_"))
+		}
+		key := "index"
+		if idx.Unique {
+			key = "uniqueIndex"
+		}
+		for i, column := range idx.Columns {
+			option := idx.Name
+			if len(idx.Columns) > 1 {
+				option += fmt.Sprintf(",priority:%d", i+1)
+			}
+			if i == 0 && idx.Where != "" {
+				option += ",where:" + idx.Where
+			}
+			settings[column] = append(settings[column], key+":"+option)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, column := range columns {
+		name := g.Naming.FieldName(column.Name)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s%d", g.Naming.FieldName(column.Name), i)
+		}
+		names[name] = true
+
+		var parts []string
+		if g.Naming.ColumnName(name) != column.Name {
+			parts = append(parts, "column:"+column.Name)
+		}
+		if column.PrimaryKey {
+			parts = append(parts, "PRIMARY KEY")
+		}
+		if !column.Nullable && !column.PrimaryKey {
+			parts = append(parts, "NOT NULL")
+		}
+		if uniques[column.Name] {
+			parts = append(parts, "UNIQUE")
+		}
+		if column.Default.Valid {
+			parts = append(parts, "DEFAULT "+column.Default.String)
+		}
+		parts = append(parts, settings[column.Name]...)
+
+		goType := goTypeOf(column.Type)
+		if column.Nullable && !column.PrimaryKey && goType != "[]byte" {
+			goType = "*" + goType
+		}
+		fields = append(fields, structField{name: name, goType: goType, tag: structTag(parts)})
+	}
+	return
+}
+
+// primaryKeys returns the names of the primary key columns
+func primaryKeys(columns []dialect.ColumnType) (pks []string) {
+	for _, column := range columns {
+		if column.PrimaryKey {
+			pks = append(pks, column.Name)
+		}
+	}
+	return
+}
+
+func isPrimaryKey(columns []dialect.ColumnType, names []string) bool {
+	pks := primaryKeys(columns)
+	sort.Strings(pks)
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return strings.Join(pks, ",") == strings.Join(sorted, ",")
+}
+
+// goTypeOf maps the declared column type to Go type by the type affinity rules of SQLite
+func goTypeOf(dataType string) string {
+	dataType = strings.ToLower(dataType)
+	switch {
+	case strings.Contains(dataType, "bool"):
+		return "bool"
+	case strings.Contains(dataType, "bigint"):
+		return "int64"
+	case strings.Contains(dataType, "int"):
+		// int is declared as integer by the dialect, so the generated model migrates to the same column type
+		return "int"
+	case strings.Contains(dataType, "char"), strings.Contains(dataType, "clob"), strings.Contains(dataType, "text"):
+		return "string"
+	case dataType == "", strings.Contains(dataType, "blob"):
+		return "[]byte"
+	case strings.Contains(dataType, "date"), strings.Contains(dataType, "time"):
+		return "time.Time"
+	case strings.Contains(dataType, "real"), strings.Contains(dataType, "floa"), strings.Contains(dataType, "doub"),
+		strings.Contains(dataType, "numeric"), strings.Contains(dataType, "decimal"):
+		return "float64"
+	}
+	return "string"
+}
+
+// structTag returns the miniorm struct tag of the settings and constraints, it is quoted by backticks if possible
+func structTag(parts []string) string {
+	if len(parts) == 0 {
+		return ""
+	}
+	tag := "miniorm:" + strconv.Quote(strings.Join(parts, ";"))
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
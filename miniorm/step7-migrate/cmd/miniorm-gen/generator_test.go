@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"miniorm"
+	"miniorm/schema"
+)
+
+// UserAccount is the model generated from table user_account in TestGenerator_Generate
+type UserAccount struct {
+	Id        int     `miniorm:"PRIMARY KEY"`
+	Email     string  `miniorm:"NOT NULL;UNIQUE"`
+	NickName  *string `miniorm:"DEFAULT 'Tom';index:idx_user_org,priority:2"`
+	OrgId     *int    `miniorm:"index:idx_user_org,priority:1,where:org_id > 0"`
+	CreatedAt *time.Time
+	Avatar    []byte
+	Visits    int64 `miniorm:"NOT NULL;DEFAULT 0"`
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "gen.db")
+	engine, err := miniorm.NewEngine("sqlite3", source)
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE user_account (id integer PRIMARY KEY, email text NOT NULL UNIQUE, nick_name text DEFAULT 'Tom', " +
+			"org_id integer, created_at datetime, avatar blob, visits bigint NOT NULL DEFAULT 0)",
+		"CREATE INDEX idx_user_org ON user_account (org_id, nick_name) WHERE org_id > 0",
+	} {
+		if _, err := s.Raw(sql).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := &Generator{Package: "model", Naming: schema.SnakeNamingStrategy{}}
+	src, err := g.Generate(engine.Migrator())
+	if err != nil {
+		t.Fatal("failed to generate", err)
+	}
+	// ignore the alignment of gofmt
+	generated := strings.Join(strings.Fields(string(src)), " ")
+	for _, want := range []string{
+		"package model",
+		`import "time"`,
+		"type UserAccount struct {",
+		"Id int `miniorm:\"PRIMARY KEY\"`",
+		"Email string `miniorm:\"NOT NULL;UNIQUE\"`",
+		"NickName *string `miniorm:\"DEFAULT 'Tom';index:idx_user_org,priority:2\"`",
+		"OrgId *int `miniorm:\"index:idx_user_org,priority:1,where:org_id > 0\"`",
+		"CreatedAt *time.Time Avatar []byte",
+		"Visits int64 `miniorm:\"NOT NULL;DEFAULT 0\"` }",
+	} {
+		if !strings.Contains(generated, want) {
+			t.Fatalf("expect %q in generated source:\n%s", want, src)
+		}
+	}
+	// the generated model migrates to the live table without any change
+	snake, err := miniorm.NewEngine("sqlite3", source, miniorm.WithNamingStrategy(schema.SnakeNamingStrategy{}))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer snake.Close()
+	if plan, err := snake.MigratePlan(&UserAccount{}); err != nil || len(plan) != 0 {
+		t.Fatalf("expect no migration of the generated model, plan: %v, err: %v", plan, err)
+	}
+	if strings.Contains(string(src), "TableName") {
+		t.Fatalf("the table name can be mapped by naming strategy:\n%s", src)
+	}
+
+	g.Naming = schema.DefaultNamingStrategy{}
+	if src, err = g.Generate(engine.Migrator()); err != nil {
+		t.Fatal("failed to generate", err)
+	}
+	if !strings.Contains(string(src), `miniorm:"column:email;NOT NULL;UNIQUE"`) ||
+		!strings.Contains(string(src), `return "user_account"`) {
+		t.Fatalf("expect the column tags and TableName method in generated source:\n%s", src)
+	}
+}
+
+func TestGenerator_CompositePrimaryKey(t *testing.T) {
+	engine, err := miniorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "gen.db"))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE user_group (user_id integer, group_id integer, PRIMARY KEY (user_id, group_id))",
+		"CREATE TABLE user_account (id integer PRIMARY KEY)",
+	} {
+		if _, err := s.Raw(sql).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := &Generator{Package: "model", Naming: schema.SnakeNamingStrategy{}}
+	if _, err = g.Generate(engine.Migrator()); err == nil || !strings.Contains(err.Error(), "(user_id, group_id)") {
+		t.Fatalf("expect the error of composite primary key, err: %v", err)
+	}
+	g.Tables = []string{"user_account"}
+	if _, err = g.Generate(engine.Migrator()); err != nil {
+		t.Fatal("failed to generate the tables without composite primary key", err)
+	}
+}
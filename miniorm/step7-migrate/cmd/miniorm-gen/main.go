@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"miniorm"
+	"miniorm/schema"
+)
+
+// miniorm-gen generates the model structs from the tables of an existing database, like:
+//  miniorm-gen -dsn ./gee.db -tables User,Post -naming snake -o model/model.go
+func main() {
+	driver := flag.String("driver", "sqlite3", "the database driver")
+	dsn := flag.String("dsn", "gee.db", "the data source name of database")
+	tables := flag.String("tables", "", "the comma separated tables to generate, all tables if empty")
+	pkg := flag.String("package", "model", "the package name of generated file")
+	naming := flag.String("naming", "default", "the naming strategy of tables and columns, default or snake")
+	output := flag.String("o", "", "the output file, stdout if empty")
+	flag.Parse()
+
+	g := &Generator{Package: *pkg}
+	switch *naming {
+	case "default":
+		g.Naming = schema.DefaultNamingStrategy{}
+	case "snake":
+		g.Naming = schema.SnakeNamingStrategy{}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown naming strategy %s\n", *naming)
+		os.Exit(2)
+	}
+	if *tables != "" {
+		g.Tables = strings.Split(*tables, ",")
+	}
+
+	engine, err := miniorm.NewEngine(*driver, *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer engine.Close()
+
+	src, err := g.Generate(engine.Migrator())
+	if err == nil {
+		if *output == "" {
+			_, err = os.Stdout.Write(src)
+		} else {
+			err = ioutil.WriteFile(*output, src, 0644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		engine.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"miniorm"
+	"miniorm/migrate"
+)
+
+// miniorm-migrate runs the .sql migrations in a directory, like:
+//  miniorm-migrate -dsn ./gee.db -dir ./migrations -- -dry-run up
+//
+// the "auto" command is not useful here because there are no models, build your own command with
+// Runner.Command to migrate the models
+func main() {
+	driver := flag.String("driver", "sqlite3", "the database driver")
+	dsn := flag.String("dsn", "gee.db", "the data source name of database")
+	dir := flag.String("dir", "migrations", "the directory of .sql migration files")
+	flag.Parse()
+
+	engine, err := miniorm.NewEngine(*driver, *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer engine.Close()
+
+	r, err := migrate.New(engine)
+	if err == nil {
+		err = r.LoadDir(*dir)
+	}
+	if err == nil {
+		err = r.Command(flag.Args(), os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		engine.Close()
+		os.Exit(1)
+	}
+}
@@ -1,19 +1,65 @@
 package dialect
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"reflect"
+	"strings"
 )
 
 var (
 	dialectsMap = map[string]Dialect{}
 )
 
-// Dialect gives 2 methods to get the datatype and check table if exist for different database
+// Dialect gives the methods to get the datatype, check table if exist and so on for different database
 type Dialect interface {
 	DataTypeOf(typ reflect.Value) (dataType string)
 	TableExistSQL(tableName string) (sql string, sqlVars []interface{})
+	IsRetryableError(err error) bool // the transaction failed with the error can be retried, like deadlock
+	ListTables(db Queryer) (tableNames []string, err error)
+	ColumnTypes(db Queryer, tableName string) (columns []ColumnType, err error)
+	Indexes(db Queryer, tableName string) (indexes []Index, err error)
+	DataSource(dataSource string) string      // adjusts the data source before open, like enabling foreign keys
+	ForeignKeysSQL(enabled bool) (sql string) // the statement to turn on/off the foreign key checks of connection
+	Quote(identifier string) string           // quotes the table or column name, "table.column" is quoted by parts
+	BindVar(index int) string                 // the placeholder of the index-th(from 1) var in sql, like "?" or "$1"
 }
 
+// Queryer is the query function of sql.DB and sql.Tx, it is used by dialect to introspect database
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ColumnType is the metadata of a column in database
+type ColumnType struct {
+	Name       string
+	Type       string         // the declared type like "integer"
+	Nullable   bool           // false if the column is NOT NULL
+	Default    sql.NullString // the default value expression like "0" or "'Tom'", invalid if no default value
+	PrimaryKey bool
+}
+
+// Index is the metadata of an index in database
+type Index struct {
+	Name     string
+	Unique   bool
+	Columns  []string
+	Where    string // the condition of partial index, empty means a full index
+	Implicit bool   // the index is created by the PRIMARY KEY or UNIQUE constraint instead of CREATE INDEX
+}
+
+// DataTyper can be implemented by the custom column type(usually a driver.Valuer and sql.Scanner) to declare
+// its column type like "text", it takes precedence over the dialect mapping
+type DataTyper interface {
+	DataType() string
+}
+
+var (
+	dataTyperType = reflect.TypeOf((*DataTyper)(nil)).Elem()
+	valuerType    = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType   = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
 func RegisterDialect(name string, dialect Dialect) {
 	dialectsMap[name] = dialect
 }
@@ -22,3 +68,52 @@ func GetDialect(name string) (dialect Dialect, ok bool) {
 	dialect, ok = dialectsMap[name]
 	return
 }
+
+// declaredDataType returns the column type declared by the DataType method of typ or *typ
+func declaredDataType(typ reflect.Type) (dataType string, ok bool) {
+	if typ.Implements(dataTyperType) {
+		return reflect.New(typ).Elem().Interface().(DataTyper).DataType(), true
+	}
+	if reflect.PtrTo(typ).Implements(dataTyperType) {
+		return reflect.New(typ).Interface().(DataTyper).DataType(), true
+	}
+	return
+}
+
+// quoteIdentifier quotes each part of the identifier like "User.Name" by the quote mark, the quote marks in name
+// are escaped by doubling, and "*" is kept as it is
+func quoteIdentifier(identifier string, quote string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		if part != "*" {
+			parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// isValuerOrScanner reports whether typ or *typ implements driver.Valuer or sql.Scanner
+func isValuerOrScanner(typ reflect.Type) bool {
+	ptr := reflect.PtrTo(typ)
+	return typ.Implements(valuerType) || ptr.Implements(valuerType) || ptr.Implements(scannerType)
+}
+
+// valuerSample returns the driver value of the zero typ, it is used to guess the column type of a driver.Valuer
+//  it returns nil if the typ is not a driver.Valuer or the zero value can not be converted
+func valuerSample(typ reflect.Type) (value driver.Value) {
+	ins := reflect.New(typ)
+	valuer, ok := ins.Elem().Interface().(driver.Valuer)
+	if !ok {
+		if valuer, ok = ins.Interface().(driver.Valuer); !ok {
+			return
+		}
+	}
+	defer func() {
+		// the Value method of zero value may panic, just ignore it
+		if p := recover(); p != nil {
+			value = nil
+		}
+	}()
+	value, _ = valuer.Value()
+	return
+}
@@ -2,6 +2,8 @@ package dialect
 
 import (
 	"reflect"
+
+	"miniorm/ormlog"
 )
 
 // TODO: mysql field type is too much to implement, (Q^Q)!
@@ -19,3 +21,43 @@ func (m *mysql) TableExistSQL(tableName string) (sql string, sqlVars []interface
 	// TODO implement me
 	panic("implement me")
 }
+
+// IsRetryableError reports false, the deadlock and lock wait timeout errors of mysql are not recognized yet
+func (m *mysql) IsRetryableError(err error) bool {
+	return false
+}
+
+// errSchemaNotSupported is returned by the methods reading the live schema, they are not implemented for mysql yet
+var errSchemaNotSupported = ormlog.New("reading the schema is not supported by mysql dialect")
+
+func (m *mysql) ListTables(db Queryer) (tableNames []string, err error) {
+	return nil, errSchemaNotSupported
+}
+
+func (m *mysql) ColumnTypes(db Queryer, tableName string) (columns []ColumnType, err error) {
+	return nil, errSchemaNotSupported
+}
+
+func (m *mysql) Indexes(db Queryer, tableName string) (indexes []Index, err error) {
+	return nil, errSchemaNotSupported
+}
+
+func (m *mysql) DataSource(dataSource string) string {
+	return dataSource
+}
+
+// Quote quotes the identifier by backticks like `User`.`Name`
+func (m *mysql) Quote(identifier string) string {
+	return quoteIdentifier(identifier, "`")
+}
+
+func (m *mysql) BindVar(index int) string {
+	return "?"
+}
+
+func (m *mysql) ForeignKeysSQL(enabled bool) (sql string) {
+	if enabled {
+		return "SET FOREIGN_KEY_CHECKS = 1"
+	}
+	return "SET FOREIGN_KEY_CHECKS = 0"
+}
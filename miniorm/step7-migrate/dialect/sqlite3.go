@@ -1,9 +1,15 @@
 package dialect
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
+
+	gosqlite3 "github.com/mattn/go-sqlite3"
 )
 
 type sqlite3 struct{}
@@ -14,8 +20,50 @@ func init() {
 
 var _ Dialect = (*sqlite3)(nil)
 
+// DataTypeOf returns the sqlite3 column type of typ
+//  the pointer maps to the nullable column of its element type, and the driver.Valuer/sql.Scanner types are
+//  supported by their DataType method, sql.Null* types or their driver value
 func (s *sqlite3) DataTypeOf(typ reflect.Value) (dataType string) {
-	switch typ.Kind() {
+	t := typ.Type()
+	if t.Kind() == reflect.Ptr {
+		return s.DataTypeOf(reflect.New(t.Elem()).Elem())
+	}
+	if dataType, ok := declaredDataType(t); ok {
+		return dataType
+	}
+	switch typ.Interface().(type) {
+	case time.Time, sql.NullTime:
+		return "datetime"
+	case sql.NullBool:
+		return "bool"
+	case sql.NullInt32:
+		return "integer"
+	case sql.NullInt64:
+		return "bigint"
+	case sql.NullFloat64:
+		return "real"
+	case sql.NullString:
+		return "text"
+	}
+
+	if isValuerOrScanner(t) {
+		switch valuerSample(t).(type) {
+		case bool:
+			return "bool"
+		case int64:
+			return "bigint"
+		case float64:
+			return "real"
+		case string:
+			return "text"
+		case []byte:
+			return "blob"
+		case time.Time:
+			return "datetime"
+		}
+	}
+
+	switch t.Kind() {
 	case reflect.Bool:
 		return "bool"
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
@@ -29,14 +77,171 @@ func (s *sqlite3) DataTypeOf(typ reflect.Value) (dataType string) {
 		return "text"
 	case reflect.Array, reflect.Slice:
 		return "blob"
-	case reflect.Struct:
-		if _, ok := typ.Interface().(time.Time); ok {
-			return "datetime"
-		}
 	}
-	panic(fmt.Sprintf("unsupported data type %s (%s) in sqlite3", typ.Type().Name(), typ.Kind()))
+	if isValuerOrScanner(t) {
+		// the column without type affinity in sqlite3 stores the value as it is
+		return "blob"
+	}
+	panic(fmt.Sprintf("unsupported data type %s (%s) in sqlite3", t.Name(), t.Kind()))
 }
 
 func (s *sqlite3) TableExistSQL(tableName string) (sql string, sqlVars []interface{}) {
 	return `SELECT name FROM sqlite_master WHERE type='table' AND name = ?`, []interface{}{tableName}
 }
+
+// IsRetryableError reports whether err is SQLITE_BUSY or SQLITE_LOCKED(including their extended codes like
+// SQLITE_BUSY_SNAPSHOT), the transaction failed with them may succeed after the lock is released
+func (s *sqlite3) IsRetryableError(err error) bool {
+	var sqliteErr gosqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == gosqlite3.ErrBusy || sqliteErr.Code == gosqlite3.ErrLocked
+}
+
+// ListTables reads the user tables from sqlite_master, the internal tables like sqlite_sequence are excluded
+func (s *sqlite3) ListTables(db Queryer) (tableNames []string, err error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		tableNames = append(tableNames, name)
+	}
+	return tableNames, rows.Err()
+}
+
+// ColumnTypes reads the columns of table by "PRAGMA table_info", the type is in lower case
+func (s *sqlite3) ColumnTypes(db Queryer, tableName string) (columns []ColumnType, err error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", s.Quote(tableName)))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			column           ColumnType
+		)
+		if err = rows.Scan(&cid, &column.Name, &column.Type, &notNull, &column.Default, &pk); err != nil {
+			return
+		}
+		// the declared type may be upper case, make it the same as DataTypeOf
+		column.Type = strings.ToLower(column.Type)
+		column.Nullable, column.PrimaryKey = notNull == 0, pk > 0
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// whereRegexp matches the condition of partial index in "CREATE INDEX ... ON User (Age) WHERE Age > 18"
+var whereRegexp = regexp.MustCompile(`(?is)\)\s*WHERE\s+(.+?)\s*;?\s*$`)
+
+// Indexes reads the indexes of table by "PRAGMA index_list" and "PRAGMA index_info", and the condition of
+// partial index is parsed from the DDL in sqlite_master
+func (s *sqlite3) Indexes(db Queryer, tableName string) (indexes []Index, err error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%s)", s.Quote(tableName)))
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			origin               string
+			index                Index
+		)
+		if err = rows.Scan(&seq, &index.Name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return
+		}
+		index.Unique, index.Implicit = unique == 1, origin != "c"
+		indexes = append(indexes, index)
+	}
+	if err = rows.Close(); err != nil {
+		return
+	}
+
+	// query the details after the index list is closed, because the connection of transaction can not be shared
+	for i := range indexes {
+		if indexes[i].Columns, err = s.indexColumns(db, indexes[i].Name); err != nil {
+			return
+		}
+		if indexes[i].Implicit {
+			continue
+		}
+		if indexes[i].Where, err = s.indexWhere(db, indexes[i].Name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *sqlite3) indexColumns(db Queryer, indexName string) (columns []string, err error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_info(%s)", s.Quote(indexName)))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seqNo, cid int
+		var name sql.NullString // it is NULL if the index column is an expression
+		if err = rows.Scan(&seqNo, &cid, &name); err != nil {
+			return
+		}
+		columns = append(columns, name.String)
+	}
+	return columns, rows.Err()
+}
+
+func (s *sqlite3) indexWhere(db Queryer, indexName string) (where string, err error) {
+	rows, err := db.Query(`SELECT sql FROM sqlite_master WHERE type = 'index' AND name = ?`, indexName)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var ddl sql.NullString
+	if rows.Next() {
+		if err = rows.Scan(&ddl); err != nil {
+			return
+		}
+	}
+	if matches := whereRegexp.FindStringSubmatch(ddl.String); matches != nil {
+		where = matches[1]
+	}
+	return where, rows.Err()
+}
+
+// DataSource enables the foreign keys of every connection by the parameter "_foreign_keys" of go-sqlite3,
+// because "PRAGMA foreign_keys" only works on the connection that runs it
+func (s *sqlite3) DataSource(dataSource string) string {
+	if strings.Contains(dataSource, "_foreign_keys=") || strings.Contains(dataSource, "_fk=") {
+		return dataSource
+	}
+	if strings.Contains(dataSource, "?") {
+		return dataSource + "&_foreign_keys=1"
+	}
+	return dataSource + "?_foreign_keys=1"
+}
+
+// Quote quotes the identifier by double quotes like "User"."Name"
+func (s *sqlite3) Quote(identifier string) string {
+	return quoteIdentifier(identifier, `"`)
+}
+
+// BindVar returns "?", sqlite3 also supports "?NNN", ":name" and "@name", but the vars of miniorm are positional
+func (s *sqlite3) BindVar(index int) string {
+	return "?"
+}
+
+// ForeignKeysSQL returns "PRAGMA foreign_keys = ON|OFF", it is a no-op in transaction
+func (s *sqlite3) ForeignKeysSQL(enabled bool) (sql string) {
+	if enabled {
+		return "PRAGMA foreign_keys = ON"
+	}
+	return "PRAGMA foreign_keys = OFF"
+}
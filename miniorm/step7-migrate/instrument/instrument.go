@@ -0,0 +1,33 @@
+package instrument
+
+import (
+	"time"
+)
+
+// the operations of transaction, the operation of statement is the first keyword of sql in lower case, like
+// "select", "insert" and "savepoint"
+const (
+	Transaction = "transaction" // the operation of transaction at Start
+	Commit      = "commit"      // the operation of transaction at Finish if it is committed
+	Rollback    = "rollback"    // the operation of transaction at Finish if it is rolled back
+)
+
+// Event is the statement or transaction run by session, the same event is passed to Start and Finish
+type Event struct {
+	Operation string
+	Table     string // the table of model in session, empty for the raw statement without model and transaction
+	SQL       string // empty for transaction
+	Vars      []interface{}
+	Start     time.Time
+	Duration  time.Duration // set before Finish
+	Err       error         // set before Finish
+	Value     interface{}   // the value set by Start and read by Finish, like a tracing span
+}
+
+// Instrumentation observes the statements and transactions of sessions, it must be safe for concurrent use
+//  Start is called before the statement runs or the transaction begins, and Finish is called after the statement
+//  runs or the transaction is committed or rolled back, the query is finished before its rows are read
+type Instrumentation interface {
+	Start(event *Event)
+	Finish(event *Event)
+}
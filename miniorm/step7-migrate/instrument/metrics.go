@@ -0,0 +1,184 @@
+package instrument
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets used by NewMetrics if no bucket is given
+var DefaultBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// Metrics is an in-memory Instrumentation keeping the latency histograms per table and operation, it is safe for
+// concurrent use, and it serves the histograms in JSON as a debug endpoint, like:
+//  http.Handle("/debug/miniorm", metrics)
+type Metrics struct {
+	mu         sync.Mutex
+	buckets    []time.Duration
+	histograms map[Key]*Histogram
+}
+
+// Key is the table and operation of histogram
+type Key struct {
+	Table     string `json:"table"`
+	Operation string `json:"operation"`
+}
+
+// Histogram counts the latencies of events by buckets
+type Histogram struct {
+	Buckets []time.Duration // the upper bounds of buckets in ascending order
+	Counts  []uint64        // the number of events in each bucket, the last one counts the events above all bounds
+	Count   uint64          // the number of events
+	Errors  uint64          // the number of failed events
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+var _ Instrumentation = (*Metrics)(nil)
+
+// NewMetrics returns the Metrics with the bucket bounds, DefaultBuckets are used if buckets are empty
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &Metrics{buckets: buckets, histograms: make(map[Key]*Histogram)}
+}
+
+func (m *Metrics) Start(event *Event) {}
+
+func (m *Metrics) Finish(event *Event) {
+	key := Key{Table: event.Table, Operation: event.Operation}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &Histogram{Buckets: m.buckets, Counts: make([]uint64, len(m.buckets)+1)}
+		m.histograms[key] = h
+	}
+	h.observe(event.Duration, event.Err != nil)
+}
+
+// Histogram returns a copy of the histogram of table and operation, ok is false if no event is observed
+func (m *Metrics) Histogram(table, operation string) (h Histogram, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached, ok := m.histograms[Key{Table: table, Operation: operation}]; ok {
+		return cached.copy(), true
+	}
+	return
+}
+
+// Snapshot returns the copies of all histograms
+func (m *Metrics) Snapshot() map[Key]Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[Key]Histogram, len(m.histograms))
+	for key, h := range m.histograms {
+		snapshot[key] = h.copy()
+	}
+	return snapshot
+}
+
+// Reset removes all histograms
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histograms = make(map[Key]*Histogram)
+}
+
+type jsonBucket struct {
+	LE    float64 `json:"le_ms"` // the upper bound in milliseconds, -1 means +Inf
+	Count uint64  `json:"count"`
+}
+
+type jsonHistogram struct {
+	Key
+	Count   uint64       `json:"count"`
+	Errors  uint64       `json:"errors"`
+	SumMS   float64      `json:"sum_ms"`
+	MaxMS   float64      `json:"max_ms"`
+	Buckets []jsonBucket `json:"buckets"`
+}
+
+// ServeHTTP writes the histograms in JSON sorted by table and operation
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot := m.Snapshot()
+	histograms := make([]jsonHistogram, 0, len(snapshot))
+	for key, h := range snapshot {
+		jh := jsonHistogram{Key: key, Count: h.Count, Errors: h.Errors, SumMS: milliseconds(h.Sum), MaxMS: milliseconds(h.Max)}
+		for i, count := range h.Counts {
+			le := float64(-1)
+			if i < len(h.Buckets) {
+				le = milliseconds(h.Buckets[i])
+			}
+			jh.Buckets = append(jh.Buckets, jsonBucket{LE: le, Count: count})
+		}
+		histograms = append(histograms, jh)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		if histograms[i].Table != histograms[j].Table {
+			return histograms[i].Table < histograms[j].Table
+		}
+		return histograms[i].Operation < histograms[j].Operation
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(histograms)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (h *Histogram) observe(d time.Duration, failed bool) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+	if failed {
+		h.Errors++
+	}
+}
+
+func (h *Histogram) copy() Histogram {
+	c := *h
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return c
+}
+
+// Mean returns the average latency, zero if no event is observed
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q-quantile of latencies, like 0.99, it is Max if the
+// quantile is above all bounds
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var count uint64
+	for i, c := range h.Counts {
+		if count += c; count >= rank && i < len(h.Buckets) {
+			return h.Buckets[i]
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,47 @@
+package instrument
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(10*time.Millisecond, time.Millisecond)
+	for _, d := range []time.Duration{500 * time.Microsecond, 2 * time.Millisecond, 20 * time.Millisecond} {
+		m.Finish(&Event{Operation: "select", Table: "User", Duration: d})
+	}
+	m.Finish(&Event{Operation: "insert", Table: "User", Duration: time.Millisecond, Err: errors.New("locked")})
+
+	h, ok := m.Histogram("User", "select")
+	if !ok || h.Count != 3 || h.Errors != 0 || h.Max != 20*time.Millisecond {
+		t.Fatalf("unexpected histogram: %+v", h)
+	}
+	if h.Counts[0] != 1 || h.Counts[1] != 1 || h.Counts[2] != 1 {
+		t.Fatalf("the events should be counted by the sorted buckets, counts: %v", h.Counts)
+	}
+	if h.Mean() != 22500*time.Microsecond/3 || h.Quantile(0.5) != 10*time.Millisecond || h.Quantile(1) != h.Max {
+		t.Fatalf("unexpected mean %v or quantiles %v %v", h.Mean(), h.Quantile(0.5), h.Quantile(1))
+	}
+	if h, ok := m.Histogram("User", "insert"); !ok || h.Errors != 1 || h.Counts[0] != 1 {
+		t.Fatalf("unexpected histogram: %+v", h)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/miniorm", nil))
+	var histograms []jsonHistogram
+	if err := json.Unmarshal(rec.Body.Bytes(), &histograms); err != nil {
+		t.Fatal(err)
+	}
+	if len(histograms) != 2 || histograms[0].Operation != "insert" || histograms[1].Count != 3 ||
+		histograms[1].Buckets[2].LE != -1 || histograms[1].Buckets[0].LE != 1 {
+		t.Fatalf("unexpected histograms: %+v", histograms)
+	}
+
+	m.Reset()
+	if len(m.Snapshot()) != 0 {
+		t.Fatal("the histograms should be removed by Reset")
+	}
+}
@@ -0,0 +1,337 @@
+package miniorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"miniorm/dialect"
+	"miniorm/ormlog"
+	"miniorm/schema"
+	"miniorm/session"
+)
+
+// MigrateStep is a DDL statement to migrate the table of model
+type MigrateStep struct {
+	Table       string
+	SQL         string
+	Destructive bool   // the step may lose data, like dropping columns or rebuilding the table
+	Reason      string // why the step is needed, like "add column Age"
+}
+
+func (step MigrateStep) String() string {
+	if step.Destructive {
+		return fmt.Sprintf("-- [DESTRUCTIVE] %s\n%s", step.Reason, step.SQL)
+	}
+	return fmt.Sprintf("-- %s\n%s", step.Reason, step.SQL)
+}
+
+// Migrate creates the tables of values if they not exist, otherwise it migrates the tables to the models
+//  the columns are added by "ALTER TABLE ADD COLUMN" if possible, the other changes like column deleting,
+//  type, nullability, default value or primary key changing are done by rebuilding the table:
+//  create the new table with the full DDL, copy the data, drop the old table and rename the new one
+//  all the steps run in one transaction, and the foreign key checks are turned off during it, otherwise the
+//  dropping of rebuilt table deletes the rows referencing it by "ON DELETE CASCADE"
+func (e *Engine) Migrate(values ...interface{}) (err error) {
+	ctx := context.Background()
+	// "PRAGMA foreign_keys" of sqlite3 is a no-op in transaction and only works on the connection that runs it,
+	// so turn it off on a dedicated connection before the transaction begins
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, e.dialect.ForeignKeysSQL(false)); err != nil {
+		return
+	}
+	defer func() {
+		// turn it on before the connection is put back to the pool
+		if _, fkErr := conn.ExecContext(ctx, e.dialect.ForeignKeysSQL(true)); fkErr != nil && err == nil {
+			err = fkErr
+		}
+	}()
+
+	_, err = e.NewSession().Conn(conn).Transaction(func(s *session.Session) (result interface{}, err error) {
+		for _, value := range values {
+			steps, err := e.migrateSteps(s.Model(value))
+			if err != nil {
+				return nil, err
+			}
+			for _, step := range steps {
+				if _, err = s.Raw(step.SQL).Exec(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return
+	})
+	return
+}
+
+// AutoMigrate migrates the tables of models in the order of their foreign key dependencies, so that the
+// referenced tables are created before the tables referencing them
+func (e *Engine) AutoMigrate(values ...interface{}) (err error) {
+	sorted, err := e.sortByDependency(values)
+	if err != nil {
+		return
+	}
+	return e.Migrate(sorted...)
+}
+
+// DropTables drops the tables of models in the reverse order of their foreign key dependencies in one transaction
+func (e *Engine) DropTables(values ...interface{}) (err error) {
+	sorted, err := e.sortByDependency(values)
+	if err != nil {
+		return
+	}
+	_, err = e.Transaction(func(s *session.Session) (result interface{}, err error) {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if err = s.Model(sorted[i]).DropTable(); err != nil {
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+// sortByDependency sorts the models by the foreign keys, the referenced ones come first
+//  the references to the tables out of models and to the table itself are ignored
+func (e *Engine) sortByDependency(values []interface{}) (sorted []interface{}, err error) {
+	s := e.NewSession()
+	tables := make(map[string]*schema.Schema)
+	var names []string
+	for _, value := range values {
+		table, err := s.Model(value).RefTable()
+		if err != nil {
+			return nil, err
+		}
+		tables[table.Name] = table
+		names = append(names, table.Name)
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch states[name] {
+		case visiting:
+			return ormlog.New(fmt.Sprintf("foreign keys of table %s form a cycle", name))
+		case visited:
+			return nil
+		}
+		states[name] = visiting
+		for _, fk := range tables[name].ForeignKeys {
+			if _, ok := tables[fk.RefTable]; ok && fk.RefTable != name {
+				if err := visit(fk.RefTable); err != nil {
+					return err
+				}
+			}
+		}
+		states[name] = visited
+		sorted = append(sorted, tables[name].Model)
+		return nil
+	}
+	for _, name := range names {
+		if err = visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// MigratePlan compares the models with the live schema and returns the ordered steps that Migrate will run,
+// but the steps are not executed, it is used to review the migration before running it
+//  the live schema is read from the primary database even if there are replicas
+func (e *Engine) MigratePlan(values ...interface{}) (plan []MigrateStep, err error) {
+	s := e.NewSession().Primary()
+	for _, value := range values {
+		steps, err := e.migrateSteps(s.Model(value))
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, steps...)
+	}
+	return
+}
+
+// migrateSteps compares the model in session with the live table and returns the DDL statements to migrate it
+func (e *Engine) migrateSteps(s *session.Session) (steps []MigrateStep, err error) {
+	table, err := s.RefTable()
+	if err != nil {
+		return
+	}
+	// if table not exist, then try to create it
+	exists, err := s.TableExists()
+	if err != nil {
+		return
+	}
+	if !exists {
+		createSQL, err := s.CreateTableSQL(table.Name)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, MigrateStep{Table: table.Name, SQL: createSQL, Reason: "create table " + table.Name})
+		return append(steps, createIndexSteps(s, table, table.Indexes)...), nil
+	}
+
+	// if table exist, then try to migrate it
+	columns, err := s.ColumnTypes()
+	if err != nil {
+		return
+	}
+	oldColumns := make(map[string]dialect.ColumnType)
+	var oldFields []string
+	for _, column := range columns {
+		oldColumns[column.Name] = column
+		oldFields = append(oldFields, column.Name)
+	}
+	// get new columns, columns to be deleted and columns to be changed
+	newFields := difference(table.FieldNames, oldFields)
+	deletedFields := difference(oldFields, table.FieldNames)
+	var changedFields []string
+	for _, field := range table.Fields {
+		if column, ok := oldColumns[field.Name]; ok && columnChanged(field, column) {
+			changedFields = append(changedFields, field.Name)
+		}
+	}
+	e.logger.Infof("table '%s' migrate: new cols %v, deleted cols %v, changed cols %v",
+		table.Name, newFields, deletedFields, changedFields)
+
+	rebuild := len(deletedFields) > 0 || len(changedFields) > 0
+	for _, name := range newFields {
+		rebuild = rebuild || !addable(table.GetField(name))
+	}
+	if !rebuild {
+		// add the new fields
+		for _, name := range newFields {
+			f := table.GetField(name)
+			steps = append(steps, MigrateStep{
+				Table: table.Name,
+				SQL: fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s %s",
+					s.Quote(table.Name), s.Quote(f.Name), f.Type, f.Constraints),
+				Reason: "add column " + f.Name,
+			})
+		}
+		indexSteps, err := migrateIndexSteps(s, table)
+		return append(steps, indexSteps...), err
+	}
+
+	// rebuild the table with the full DDL of model, and copy the data of the kept columns
+	tmpTable := "tmp_" + table.Name
+	createSQL, err := s.CreateTableSQL(tmpTable)
+	if err != nil {
+		return
+	}
+	var keptFields []string
+	for _, name := range difference(table.FieldNames, newFields) {
+		keptFields = append(keptFields, s.Quote(name))
+	}
+	kept := strings.Join(keptFields, ", ")
+	reason := fmt.Sprintf("rebuild table %s: new cols %v, deleted cols %v, changed cols %v",
+		table.Name, newFields, deletedFields, changedFields)
+	for _, sql := range []string{
+		createSQL,
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", s.Quote(tmpTable), kept, kept, s.Quote(table.Name)),
+		fmt.Sprintf("DROP TABLE %s", s.Quote(table.Name)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", s.Quote(tmpTable), s.Quote(table.Name)),
+	} {
+		steps = append(steps, MigrateStep{Table: table.Name, SQL: sql, Destructive: true, Reason: reason})
+	}
+	// the indexes of old table are dropped with it, so create all the indexes of model
+	return append(steps, createIndexSteps(s, table, table.Indexes)...), nil
+}
+
+func createIndexSteps(s *session.Session, table *schema.Schema, indexes []*schema.Index) (steps []MigrateStep) {
+	for _, index := range indexes {
+		steps = append(steps, MigrateStep{
+			Table:  table.Name,
+			SQL:    s.CreateIndexSQL(index, table.Name),
+			Reason: "create index " + index.Name,
+		})
+	}
+	return
+}
+
+// migrateIndexSteps compares the indexes of model with the live ones, it creates the missing indexes,
+// drops the stale ones and recreates the changed ones
+//  only the indexes created by CREATE INDEX are managed, the ones of PRIMARY KEY and UNIQUE constraints are not
+func migrateIndexSteps(s *session.Session, table *schema.Schema) (steps []MigrateStep, err error) {
+	indexes, err := s.Indexes()
+	if err != nil {
+		return
+	}
+	oldIndexes := make(map[string]dialect.Index)
+	for _, index := range indexes {
+		if !index.Implicit {
+			oldIndexes[index.Name] = index
+		}
+	}
+	var missing []*schema.Index
+	for _, index := range table.Indexes {
+		old, ok := oldIndexes[index.Name]
+		delete(oldIndexes, index.Name)
+		if ok && !indexChanged(index, old) {
+			continue
+		}
+		if ok {
+			steps = append(steps, MigrateStep{
+				Table:  table.Name,
+				SQL:    s.DropIndexSQL(index.Name),
+				Reason: "drop changed index " + index.Name,
+			})
+		}
+		missing = append(missing, index)
+	}
+	for _, index := range indexes {
+		if _, ok := oldIndexes[index.Name]; ok {
+			steps = append(steps, MigrateStep{
+				Table:  table.Name,
+				SQL:    s.DropIndexSQL(index.Name),
+				Reason: "drop stale index " + index.Name,
+			})
+		}
+	}
+	return append(steps, createIndexSteps(s, table, missing)...), nil
+}
+
+// indexChanged reports whether the uniqueness, columns or condition of index is changed
+func indexChanged(index *schema.Index, old dialect.Index) bool {
+	return index.Unique != old.Unique ||
+		strings.Join(index.FieldNames(), ",") != strings.Join(old.Columns, ",") ||
+		!strings.EqualFold(strings.Join(strings.Fields(index.Where), " "), strings.Join(strings.Fields(old.Where), " "))
+}
+
+// columnChanged reports whether the type, nullability, default value or primary key of column is changed
+func columnChanged(field *schema.Field, column dialect.ColumnType) bool {
+	defaultValue, hasDefault := field.Default()
+	return !strings.EqualFold(field.Type, column.Type) ||
+		field.Nullable() != column.Nullable ||
+		field.PrimaryKey != column.PrimaryKey ||
+		hasDefault != column.Default.Valid ||
+		defaultValue != column.Default.String
+}
+
+// addable reports whether the column can be added by "ALTER TABLE ADD COLUMN",
+// the PRIMARY KEY, UNIQUE and NOT NULL without default value columns can not be added in this way
+func addable(field *schema.Field) bool {
+	_, hasDefault := field.Default()
+	return !field.PrimaryKey && !field.Unique() && (field.Nullable() || hasDefault)
+}
+
+// difference returns element in array a and not in array b.In short, it returns (a - b)
+func difference(a, b []string) (diff []string) {
+	mapB := make(map[string]struct{})
+	for _, e := range b {
+		mapB[e] = struct{}{}
+	}
+	for _, e := range a {
+		if _, ok := mapB[e]; !ok {
+			diff = append(diff, e)
+		}
+	}
+	return
+}
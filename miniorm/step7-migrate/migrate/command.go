@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"miniorm/ormlog"
+)
+
+const usage = `usage: [-dry-run] <command>
+commands:
+  up        apply all the pending migrations
+  down [n]  revert the last n(default 1) applied migrations
+  redo      revert the last applied migration and apply it again
+  status    print the states of migrations
+  auto      migrate the tables of models by Engine.Migrate
+`
+
+// Command runs the migration command given by args, it is used to build the migration command line tool,
+// the models are migrated by the "auto" command
+//  with -dry-run, the commands print what they will do instead of running it, like the DDL plan of "auto", nothing is written
+//  to the database, the missing table schema_migrations means no migration is applied
+func (r *Runner) Command(args []string, out io.Writer, models ...interface{}) (err error) {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() { fmt.Fprint(out, usage) }
+	dryRun := flags.Bool("dry-run", false, "print the plan instead of running it")
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ormlog.New("missing command")
+	}
+
+	switch cmd := flags.Arg(0); cmd {
+	case "up":
+		if *dryRun {
+			// the tables of runner are not created in dry run
+			pending, err := r.pending()
+			if err != nil {
+				return err
+			}
+			for _, m := range pending {
+				printMigration(out, "up", m.ID, m.UpSQL)
+			}
+			return nil
+		}
+		applied, err := r.Up()
+		fmt.Fprintf(out, "applied: %v\n", applied)
+		return err
+	case "down", "redo":
+		n := 1
+		if cmd == "down" && flags.NArg() > 1 {
+			if n, err = strconv.Atoi(flags.Arg(1)); err != nil {
+				return ormlog.New("invalid number of migrations to revert: " + flags.Arg(1))
+			}
+		}
+		if *dryRun {
+			return r.printDown(out, n, cmd == "redo")
+		}
+		if cmd == "redo" {
+			return r.Redo()
+		}
+		reverted, err := r.Down(n)
+		fmt.Fprintf(out, "reverted: %v\n", reverted)
+		return err
+	case "status":
+		status := r.Status
+		if *dryRun {
+			status = r.status
+		}
+		statuses, err := status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%s\t%s\n", status.ID, state)
+		}
+		return nil
+	case "auto":
+		if *dryRun {
+			plan, err := r.engine.MigratePlan(models...)
+			if err != nil {
+				return err
+			}
+			for _, step := range plan {
+				fmt.Fprintf(out, "%s\n", step)
+			}
+			return nil
+		}
+		return r.engine.Migrate(models...)
+	default:
+		flags.Usage()
+		return ormlog.New("unknown command " + cmd)
+	}
+}
+
+// printDown prints the last n applied migrations to revert, and the up of them if redo
+func (r *Runner) printDown(out io.Writer, n int, redo bool) (err error) {
+	ids, err := r.appliedDesc()
+	if err != nil {
+		return
+	}
+	for i := 0; i < n && i < len(ids); i++ {
+		var downSQL, upSQL string
+		if m := r.find(ids[i]); m != nil {
+			downSQL, upSQL = m.DownSQL, m.UpSQL
+		}
+		printMigration(out, "down", ids[i], downSQL)
+		if redo {
+			printMigration(out, "up", ids[i], upSQL)
+		}
+	}
+	return
+}
+
+func printMigration(out io.Writer, direction, id, sql string) {
+	if sql == "" {
+		sql = "-- (go function)"
+	}
+	fmt.Fprintf(out, "-- migration %s %s\n%s\n", id, direction, strings.TrimSpace(sql))
+}
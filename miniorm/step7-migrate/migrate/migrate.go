@@ -0,0 +1,363 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"miniorm"
+	"miniorm/ormlog"
+	"miniorm/session"
+)
+
+const (
+	// TableName is the table to record the applied migrations
+	TableName = "schema_migrations"
+	// LockTableName is the table to make sure only one process migrates at once
+	LockTableName = "schema_migrations_lock"
+)
+
+// ErrLocked is returned when another process is migrating the database
+var ErrLocked = ormlog.New("migration is locked by another process")
+
+// Migration is a hand-written change of database, the migrations are applied in the order of ID,
+// so the ID is usually a sortable version like "20220601120000_create_user"
+type Migration struct {
+	ID      string
+	Up      func(*session.Session) error
+	Down    func(*session.Session) error // nil means the migration can not be reverted
+	UpSQL   string                       // the SQL of Up if it is loaded from file, it is printed in dry-run mode
+	DownSQL string                       // the SQL of Down if it is loaded from file
+}
+
+// Status is the state of a registered migration
+type Status struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time // zero if the migration is not applied
+}
+
+// Runner applies and reverts the registered migrations, the applied IDs are recorded in table schema_migrations
+type Runner struct {
+	engine     *miniorm.Engine
+	migrations []*Migration // sorted by ID
+	owner      string       // the owner of migration lock
+}
+
+func New(engine *miniorm.Engine, migrations ...*Migration) (r *Runner, err error) {
+	host, _ := os.Hostname()
+	r = &Runner{
+		engine: engine,
+		owner:  fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+	}
+	if err = r.Register(migrations...); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Register adds the migrations to runner, the ID must be unique
+func (r *Runner) Register(migrations ...*Migration) (err error) {
+	for _, m := range migrations {
+		if m.ID == "" || m.Up == nil {
+			return ormlog.New("migration must have ID and Up")
+		}
+		if r.find(m.ID) != nil {
+			return ormlog.New(fmt.Sprintf("migration %s is duplicated", m.ID))
+		}
+		r.migrations = append(r.migrations, m)
+	}
+	sort.Slice(r.migrations, func(i, j int) bool {
+		return r.migrations[i].ID < r.migrations[j].ID
+	})
+	return
+}
+
+// LoadDir registers the migrations from .sql files in dir, see LoadFS
+func (r *Runner) LoadDir(dir string) (err error) {
+	return r.LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS registers the migrations from .sql files in dir of fsys, the files are named like
+// "<ID>.up.sql" and "<ID>.down.sql", the down file is optional
+//  NOTES: the content of file is executed by one Exec, so the driver must support multiple statements
+func (r *Runner) LoadFS(fsys fs.FS, dir string) (err error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return
+	}
+	ups, downs := make(map[string]string), make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			ups[strings.TrimSuffix(name, ".up.sql")] = string(content)
+		case strings.HasSuffix(name, ".down.sql"):
+			downs[strings.TrimSuffix(name, ".down.sql")] = string(content)
+		}
+	}
+	var migrations []*Migration
+	for id, up := range ups {
+		m := &Migration{ID: id, Up: execSQL(up), UpSQL: up}
+		if down, ok := downs[id]; ok {
+			m.Down, m.DownSQL = execSQL(down), down
+		}
+		migrations = append(migrations, m)
+	}
+	for id := range downs {
+		if _, ok := ups[id]; !ok {
+			return ormlog.New(fmt.Sprintf("migration %s has no up file", id))
+		}
+	}
+	return r.Register(migrations...)
+}
+
+func execSQL(sql string) func(*session.Session) error {
+	return func(s *session.Session) (err error) {
+		_, err = s.Raw(sql).Exec()
+		return
+	}
+}
+
+// Pending returns the migrations that are not applied in order
+func (r *Runner) Pending() (pending []*Migration, err error) {
+	if err = r.createTables(); err != nil {
+		return
+	}
+	return r.pending()
+}
+
+// pending returns the pending migrations without creating the tables of runner, it is used by dry run
+func (r *Runner) pending() (pending []*Migration, err error) {
+	appliedAt, err := r.applied()
+	if err != nil {
+		return
+	}
+	for _, m := range r.migrations {
+		if _, ok := appliedAt[m.ID]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return
+}
+
+// Up applies all the pending migrations in order, it stops at the first failed one
+func (r *Runner) Up() (applied []string, err error) {
+	err = r.withLock(func() (err error) {
+		appliedAt, err := r.applied()
+		if err != nil {
+			return
+		}
+		for _, m := range r.migrations {
+			if _, ok := appliedAt[m.ID]; ok {
+				continue
+			}
+			if err = r.up(m); err != nil {
+				return
+			}
+			applied = append(applied, m.ID)
+		}
+		return
+	})
+	return
+}
+
+// Down reverts the last n applied migrations in reverse order
+func (r *Runner) Down(n int) (reverted []string, err error) {
+	err = r.withLock(func() (err error) {
+		ids, err := r.appliedDesc()
+		if err != nil {
+			return
+		}
+		for i := 0; i < n && i < len(ids); i++ {
+			if err = r.down(ids[i]); err != nil {
+				return
+			}
+			reverted = append(reverted, ids[i])
+		}
+		return
+	})
+	return
+}
+
+// Redo reverts the last applied migration and applies it again
+func (r *Runner) Redo() (err error) {
+	return r.withLock(func() (err error) {
+		ids, err := r.appliedDesc()
+		if err != nil || len(ids) == 0 {
+			return
+		}
+		if err = r.down(ids[0]); err != nil {
+			return
+		}
+		return r.up(r.find(ids[0]))
+	})
+}
+
+// Status returns the states of the registered migrations in order
+func (r *Runner) Status() (statuses []Status, err error) {
+	if err = r.createTables(); err != nil {
+		return
+	}
+	return r.status()
+}
+
+// status returns the states of migrations without creating the tables of runner, it is used by dry run
+func (r *Runner) status() (statuses []Status, err error) {
+	appliedAt, err := r.applied()
+	if err != nil {
+		return
+	}
+	for _, m := range r.migrations {
+		at, ok := appliedAt[m.ID]
+		statuses = append(statuses, Status{ID: m.ID, Applied: ok, AppliedAt: at})
+	}
+	return
+}
+
+// ForceUnlock releases the migration lock held by any process, it is used when the process crashed while migrating
+func (r *Runner) ForceUnlock() (err error) {
+	if err = r.createTables(); err != nil {
+		return
+	}
+	s := r.session()
+	_, err = s.Raw(fmt.Sprintf("DELETE FROM %s", s.Quote(LockTableName))).Exec()
+	return
+}
+
+// up applies the migration and records it in one transaction
+func (r *Runner) up(m *Migration) (err error) {
+	r.engine.Logger().Infof("migration %s up", m.ID)
+	_, err = r.engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		if err = m.Up(s); err != nil {
+			return nil, ormlog.New(fmt.Sprintf("failed to apply migration %s: %v", m.ID, err))
+		}
+		_, err = s.Raw(fmt.Sprintf("INSERT INTO %s (id, applied_at) VALUES (?, ?)", s.Quote(TableName)), m.ID, time.Now()).Exec()
+		return
+	})
+	return
+}
+
+// down reverts the migration and removes its record in one transaction
+func (r *Runner) down(id string) (err error) {
+	m := r.find(id)
+	if m == nil {
+		return ormlog.New(fmt.Sprintf("applied migration %s is not registered", id))
+	}
+	if m.Down == nil {
+		return ormlog.New(fmt.Sprintf("migration %s can not be reverted", id))
+	}
+	r.engine.Logger().Infof("migration %s down", m.ID)
+	_, err = r.engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		if err = m.Down(s); err != nil {
+			return nil, ormlog.New(fmt.Sprintf("failed to revert migration %s: %v", m.ID, err))
+		}
+		_, err = s.Raw(fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.Quote(TableName)), m.ID).Exec()
+		return
+	})
+	return
+}
+
+// session returns a session on the primary database, the records and the lock are never read from a replica
+// because of the replication lag
+func (r *Runner) session() *session.Session {
+	return r.engine.NewSession().Primary()
+}
+
+func (r *Runner) find(id string) *Migration {
+	for _, m := range r.migrations {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// applied returns the applied migration IDs and their applied time, nothing is applied if table
+// schema_migrations does not exist
+func (r *Runner) applied() (appliedAt map[string]time.Time, err error) {
+	if exists, err := r.engine.Migrator().HasTable(TableName); err != nil || !exists {
+		return nil, err
+	}
+	s := r.session()
+	rows, err := s.Raw(fmt.Sprintf("SELECT id, applied_at FROM %s", s.Quote(TableName))).QueryRows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	appliedAt = make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err = rows.Scan(&id, &at); err != nil {
+			return
+		}
+		appliedAt[id] = at
+	}
+	return appliedAt, rows.Err()
+}
+
+// appliedDesc returns the applied migration IDs in reverse order
+func (r *Runner) appliedDesc() (ids []string, err error) {
+	appliedAt, err := r.applied()
+	if err != nil {
+		return
+	}
+	for id := range appliedAt {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return
+}
+
+func (r *Runner) createTables() (err error) {
+	s := r.session()
+	if _, err = s.Raw(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, applied_at datetime NOT NULL)",
+		s.Quote(TableName))).Exec(); err != nil {
+		return
+	}
+	_, err = s.Raw(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id integer PRIMARY KEY, owner text NOT NULL, locked_at datetime NOT NULL)",
+		s.Quote(LockTableName))).Exec()
+	return
+}
+
+// withLock runs f while holding the migration lock, ErrLocked is returned if the lock is held by another process
+//  the lock is a row in table schema_migrations_lock, the primary key makes sure only one row can be inserted
+func (r *Runner) withLock(f func() error) (err error) {
+	if err = r.createTables(); err != nil {
+		return
+	}
+	s := r.session()
+	_, err = s.Raw(fmt.Sprintf("INSERT INTO %s (id, owner, locked_at) VALUES (1, ?, ?)", s.Quote(LockTableName)),
+		r.owner, time.Now()).Exec()
+	if err != nil {
+		var owner string
+		row := s.Raw(fmt.Sprintf("SELECT owner FROM %s WHERE id = 1", s.Quote(LockTableName))).QueryRow()
+		if scanErr := row.Scan(&owner); scanErr == nil {
+			return fmt.Errorf("%w: %s", ErrLocked, owner)
+		} else if !errors.Is(scanErr, sql.ErrNoRows) {
+			return scanErr
+		}
+		return
+	}
+	defer func() {
+		_, unlockErr := s.Raw(fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND owner = ?", s.Quote(LockTableName)), r.owner).Exec()
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+	return f()
+}
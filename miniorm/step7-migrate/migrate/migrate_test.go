@@ -0,0 +1,230 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"miniorm"
+	"miniorm/session"
+)
+
+func openDB(t *testing.T) *miniorm.Engine {
+	t.Helper()
+	engine, err := miniorm.NewEngine("sqlite3", "../gee.db")
+	if err != nil {
+		t.Fatal("failed to connect ", err)
+	}
+	s := engine.NewSession()
+	for _, table := range []string{TableName, LockTableName, "Book", "Author"} {
+		if _, err = s.Raw("DROP TABLE IF EXISTS " + table).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engine
+}
+
+var testFS = fstest.MapFS{
+	"sql/001_create_book.up.sql":   {Data: []byte("CREATE TABLE Book (Id integer PRIMARY KEY, Title text);")},
+	"sql/001_create_book.down.sql": {Data: []byte("DROP TABLE Book;")},
+	"sql/003_add_price.up.sql":     {Data: []byte("ALTER TABLE Book ADD COLUMN Price real;")},
+}
+
+var createAuthor = &Migration{
+	ID: "002_create_author",
+	Up: func(s *session.Session) (err error) {
+		_, err = s.Raw("CREATE TABLE Author (Id integer PRIMARY KEY, Name text)").Exec()
+		return
+	},
+	Down: func(s *session.Session) (err error) {
+		_, err = s.Raw("DROP TABLE Author").Exec()
+		return
+	},
+}
+
+func testRunner(t *testing.T, engine *miniorm.Engine) *Runner {
+	t.Helper()
+	r, err := New(engine, createAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.LoadFS(testFS, "sql"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRunner_Up(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	r := testRunner(t, engine)
+	applied, err := r.Up()
+	if err != nil || len(applied) != 3 || applied[1] != createAuthor.ID {
+		t.Fatalf("failed to apply migrations in order, applied: %v, err: %v", applied, err)
+	}
+	if applied, err = r.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("expected no pending migrations, applied: %v, err: %v", applied, err)
+	}
+
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Fatalf("failed to record the applied migration %s", status.ID)
+		}
+	}
+}
+
+func TestRunner_Down(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	r := testRunner(t, engine)
+	if _, err := r.Up(); err != nil {
+		t.Fatal(err)
+	}
+	// the last migration has no down file
+	if _, err := r.Down(1); err == nil {
+		t.Fatal("expected error when revert the migration without down")
+	}
+
+	r = testRunner(t, engine)
+	if _, err := engine.NewSession().Raw("DELETE FROM "+TableName+" WHERE id = ?", "003_add_price").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := r.Down(2)
+	if err != nil || len(reverted) != 2 || reverted[0] != createAuthor.ID {
+		t.Fatalf("failed to revert migrations in reverse order, reverted: %v, err: %v", reverted, err)
+	}
+	var count int
+	row := engine.NewSession().Raw("SELECT count(*) FROM sqlite_master WHERE name IN ('Book', 'Author')").QueryRow()
+	if err = row.Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("failed to drop the tables by down migrations, %d tables left", count)
+	}
+}
+
+func TestRunner_Redo(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	r, err := New(engine, createAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Redo(); err != nil {
+		t.Fatalf("failed to redo the last migration, err: %v", err)
+	}
+	statuses, err := r.Status()
+	if err != nil || len(statuses) != 1 || !statuses[0].Applied {
+		t.Fatalf("failed to apply the migration again, statuses: %v, err: %v", statuses, err)
+	}
+}
+
+func TestRunner_Lock(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	other, _ := New(engine)
+	r := testRunner(t, engine)
+	err := other.withLock(func() error {
+		_, err := r.Up()
+		return err
+	})
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked when another process is migrating, err: %v", err)
+	}
+	if _, err = r.Up(); err != nil {
+		t.Fatalf("failed to migrate after the lock is released, err: %v", err)
+	}
+}
+
+func TestRunner_Replicas(t *testing.T) {
+	dir := t.TempDir()
+	// the replica is empty, the runner fails if it reads the records or the live schema from it
+	engine, err := miniorm.NewEngine("sqlite3", filepath.Join(dir, "primary.db"),
+		miniorm.WithReplicas(filepath.Join(dir, "replica.db")))
+	if err != nil {
+		t.Fatal("failed to connect ", err)
+	}
+	defer engine.Close()
+	r := testRunner(t, engine)
+	if applied, err := r.Up(); err != nil || len(applied) != 3 {
+		t.Fatalf("failed to apply migrations, applied: %v, err: %v", applied, err)
+	}
+	if pending, err := r.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("the applied migrations should be read from primary, pending: %d, err: %v", len(pending), err)
+	}
+	if err = r.withLock(func() error { return nil }); err != nil {
+		t.Fatalf("failed to lock on primary, err: %v", err)
+	}
+
+	plan, err := engine.MigratePlan(&Book{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range plan {
+		if strings.HasPrefix(step.SQL, "CREATE TABLE") && !step.Destructive {
+			t.Fatalf("the live schema should be read from primary, plan: %v", plan)
+		}
+	}
+}
+
+type Book struct {
+	Id    int `miniorm:"PRIMARY KEY"`
+	Title string
+}
+
+func TestRunner_Command(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	r := testRunner(t, engine)
+
+	var out bytes.Buffer
+	if err := r.Command([]string{"-dry-run", "status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "001_create_book\tpending") {
+		t.Fatalf("failed to print the states of migrations, output:\n%s", out.String())
+	}
+	for _, table := range []string{TableName, LockTableName} {
+		if exists, err := engine.Migrator().HasTable(table); err != nil || exists {
+			t.Fatalf("dry-run status should not create table %s, exists: %v, err: %v", table, exists, err)
+		}
+	}
+
+	out.Reset()
+	if err := r.Command([]string{"-dry-run", "up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "ALTER TABLE Book ADD COLUMN Price real;") {
+		t.Fatalf("failed to print the pending migrations, output:\n%s", out.String())
+	}
+	if exists, err := engine.Migrator().HasTable(TableName); err != nil || exists {
+		t.Fatalf("dry-run should not create table %s, exists: %v, err: %v", TableName, exists, err)
+	}
+	if pending, err := r.Pending(); err != nil || len(pending) != 3 {
+		t.Fatalf("dry-run should not apply migrations, pending: %d, err: %v", len(pending), err)
+	}
+
+	out.Reset()
+	if err := r.Command([]string{"-dry-run", "auto"}, &out, &Book{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `CREATE TABLE "Book"`) {
+		t.Fatalf("failed to print the migrate plan of models, output:\n%s", out.String())
+	}
+
+	if err := r.Command([]string{"unknown"}, &out); err == nil {
+		t.Fatal("expected error for unknown command")
+	}
+}
@@ -0,0 +1,70 @@
+package miniorm
+
+import (
+	"miniorm/dialect"
+)
+
+// Migrator introspects the schema of the database connected by engine, it is backed by the dialect
+type Migrator struct {
+	engine *Engine
+}
+
+func (e *Engine) Migrator() *Migrator {
+	return &Migrator{engine: e}
+}
+
+// ListTables returns the names of user tables in database
+func (m *Migrator) ListTables() (tableNames []string, err error) {
+	return m.engine.dialect.ListTables(m.engine.db)
+}
+
+func (m *Migrator) HasTable(tableName string) (exists bool, err error) {
+	tableNames, err := m.ListTables()
+	if err != nil {
+		return
+	}
+	for _, name := range tableNames {
+		if name == tableName {
+			return true, nil
+		}
+	}
+	return
+}
+
+// ColumnTypes returns the name, type, nullability, default value and primary key of the columns of table
+func (m *Migrator) ColumnTypes(tableName string) (columns []dialect.ColumnType, err error) {
+	return m.engine.dialect.ColumnTypes(m.engine.db, tableName)
+}
+
+// HasColumn reports whether the table has the column with the given name
+func (m *Migrator) HasColumn(tableName, columnName string) (exists bool, err error) {
+	columns, err := m.ColumnTypes(tableName)
+	if err != nil {
+		return
+	}
+	for _, column := range columns {
+		if column.Name == columnName {
+			return true, nil
+		}
+	}
+	return
+}
+
+// Indexes returns the indexes of table, including the implicit ones created by PRIMARY KEY and UNIQUE constraints
+func (m *Migrator) Indexes(tableName string) (indexes []dialect.Index, err error) {
+	return m.engine.dialect.Indexes(m.engine.db, tableName)
+}
+
+// HasIndex reports whether the table has the index with the given name
+func (m *Migrator) HasIndex(tableName, indexName string) (exists bool, err error) {
+	indexes, err := m.Indexes(tableName)
+	if err != nil {
+		return
+	}
+	for _, index := range indexes {
+		if index.Name == indexName {
+			return true, nil
+		}
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package miniorm
+
+import (
+	"testing"
+)
+
+type Product struct {
+	Id    int    `miniorm:"PRIMARY KEY"`
+	Code  string `miniorm:"NOT NULL UNIQUE"`
+	Price int    `miniorm:"DEFAULT 0;index"`
+}
+
+func TestMigrator(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	s := engine.NewSession().Model(&Product{})
+	if err1, err2 := s.DropTable(), s.CreateTable(); err1 != nil || err2 != nil {
+		t.Fatalf("failed to create table, drop-table-err: %v, create-table-err: %v", err1, err2)
+	}
+
+	m := engine.Migrator()
+	if exists, err := m.HasTable("Product"); err != nil || !exists {
+		t.Fatalf("failed to list table Product, err: %v", err)
+	}
+	if exists, err := m.HasTable("sqlite_sequence"); err != nil || exists {
+		t.Fatalf("the internal tables should not be listed, err: %v", err)
+	}
+
+	columns, err := m.ColumnTypes("Product")
+	if err != nil || len(columns) != 3 {
+		t.Fatalf("failed to get columns of Product, columns: %v, err: %v", columns, err)
+	}
+	id, code, price := columns[0], columns[1], columns[2]
+	if !id.PrimaryKey || code.Nullable || code.Type != "text" || !price.Nullable || price.Default.String != "0" {
+		t.Fatalf("failed to get column types of Product, columns: %+v", columns)
+	}
+	if exists, err := m.HasColumn("Product", "Price"); err != nil || !exists {
+		t.Fatalf("failed to find column Price, err: %v", err)
+	}
+
+	indexes, err := m.Indexes("Product")
+	if err != nil || len(indexes) != 2 {
+		t.Fatalf("failed to get indexes of Product, indexes: %+v, err: %v", indexes, err)
+	}
+	for _, index := range indexes {
+		if index.Implicit != (index.Name != "idx_Product_Price") {
+			t.Fatalf("failed to tell the implicit index, index: %+v", index)
+		}
+	}
+	if exists, err := m.HasIndex("Product", "idx_Product_Price"); err != nil || !exists {
+		t.Fatalf("failed to find index idx_Product_Price, err: %v", err)
+	}
+}
@@ -1,50 +1,261 @@
 package miniorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"strings"
+	"time"
 
+	"miniorm/cache"
 	"miniorm/dialect"
+	"miniorm/instrument"
 	"miniorm/ormlog"
+	"miniorm/schema"
 	"miniorm/session"
 )
 
 type Engine struct {
-	db      *sql.DB
-	dialect dialect.Dialect
+	db              *sql.DB
+	dialect         dialect.Dialect
+	naming          schema.NamingStrategy
+	schemas         *schema.Cache      // the parsed schemas of models shared by sessions
+	stmts           *session.StmtCache // the prepared statements shared by sessions, nil means no cache
+	cache           cache.Cache        // the query results shared by sessions, nil means no cache
+	logger          ormlog.Logger
+	slow            time.Duration              // the slow threshold of sessions
+	instrumentation instrument.Instrumentation // observes the statements and transactions of sessions, nil means no one
+
+	replicas  *session.Replicas            // the read statements run on replicas, nil means no replica
+	shardings map[string]*session.Sharding // the sharded tables, the key is the table name of model
+
+	// the settings of options applied after the database connected
+	dialectName     string
+	stmtCacheSize   int
+	maxOpenConns    int
+	connMaxLifetime time.Duration
+	replicaSources  []string
+	replicaPolicy   session.ReplicaPolicy
+	shardingConfigs []shardingConfig
+}
+
+// shardingConfig is the sharding of model given by WithSharding, it is resolved after the options applied
+type shardingConfig struct {
+	model       interface{}
+	sharding    session.Sharding
+	dataSources []string
 }
 
-func NewEngine(driver, dataSource string) (e *Engine, err error) {
-	db, err := sql.Open(driver, dataSource)
+// NewEngine connects the database and returns the engine, the dialect is the one registered by the driver name
+// unless WithDialect is given
+func NewEngine(driver, dataSource string, opts ...Option) (e *Engine, err error) {
+	e = newEngine(opts)
+	dialectName := driver
+	if e.dialectName != "" {
+		dialectName = e.dialectName
+	}
+	// make sure the specific dialect exists
+	dial, ok := dialect.GetDialect(dialectName)
+	if !ok {
+		return nil, ormlog.New(fmt.Sprintf("dialect %s NOT FOUND", dialectName))
+	}
+	db, err := sql.Open(driver, dial.DataSource(dataSource))
 	if err != nil {
-		ormlog.Error(err)
-		return
+		e.logger.Errorf("%v", err)
+		return nil, err
 	}
 	if err = db.Ping(); err != nil {
-		ormlog.Error(err)
-		return
+		e.logger.Errorf("%v", err)
+		_ = db.Close()
+		return nil, err
 	}
-	// make sure the specific dialect exists
-	dial, ok := dialect.GetDialect(driver)
+	if err = e.init(db, dial, driver); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// NewEngineFromDB returns the engine on the connected db, like the one shared with other libraries, the dialect is
+// the one registered by dialectName, and WithDialect is ignored
+//  the db is closed by Engine.Close, and the replicas and shards given by data sources are connected by the driver
+//  of dialectName
+//  the data source of db is not adjusted by the dialect, so the foreign keys of sqlite3 must be enabled by the
+//  caller, like "?_foreign_keys=1" of go-sqlite3, otherwise "ON DELETE CASCADE" and the other constraints of
+//  foreign keys are not enforced
+func NewEngineFromDB(db *sql.DB, dialectName string, opts ...Option) (e *Engine, err error) {
+	e = newEngine(opts)
+	dial, ok := dialect.GetDialect(dialectName)
 	if !ok {
-		return nil, ormlog.New(fmt.Sprintf("dialect %s NOT FOUND", driver))
+		return nil, ormlog.New(fmt.Sprintf("dialect %s NOT FOUND", dialectName))
+	}
+	if err = e.init(db, dial, dialectName); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func newEngine(opts []Option) (e *Engine) {
+	e = &Engine{naming: schema.DefaultNamingStrategy{}, schemas: &schema.Cache{}, logger: ormlog.Default,
+		slow: session.DefaultSlowThreshold}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return
+}
+
+// init applies the settings of options on the connected db, the db is closed on error
+func (e *Engine) init(db *sql.DB, dial dialect.Dialect, driver string) (err error) {
+	e.db, e.dialect = db, dial
+	e.tune(db)
+	if e.stmtCacheSize > 0 {
+		e.stmts = session.NewStmtCache(db, e.stmtCacheSize)
+	}
+	if err = e.openReplicas(driver); err == nil {
+		err = e.openShardings(driver)
+	}
+	if err != nil {
+		e.logger.Errorf("%v", err)
+		_ = e.Close()
+		return
+	}
+	e.logger.Infof("database connected")
+	return
+}
+
+// tune sets the connection pool of db by the options
+func (e *Engine) tune(db *sql.DB) {
+	if e.maxOpenConns > 0 {
+		db.SetMaxOpenConns(e.maxOpenConns)
+	}
+	if e.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(e.connMaxLifetime)
+	}
+}
+
+// openReplicas connects the replicas given by WithReplicas with the same driver of primary database
+func (e *Engine) openReplicas(driver string) error {
+	dbs, err := e.openDBs(driver, e.replicaSources)
+	if err != nil {
+		return err
+	}
+	if len(dbs) > 0 {
+		e.replicas = session.NewReplicas(dbs, e.replicaPolicy)
+	}
+	return nil
+}
+
+// openShardings connects the shards given by WithSharding, and registers the shardings by the table name of model
+func (e *Engine) openShardings(driver string) error {
+	for _, config := range e.shardingConfigs {
+		table, err := e.schemas.Parse(config.model, e.dialect, e.naming)
+		if err != nil {
+			return err
+		}
+		sharding := config.sharding
+		if len(config.dataSources) == 0 && sharding.Shards <= 0 {
+			return ormlog.New(fmt.Sprintf("the sharding of table %s has no shard", table.Name))
+		}
+		if sharding.DBs, err = e.openDBs(driver, config.dataSources); err != nil {
+			return err
+		}
+		if e.shardings == nil {
+			e.shardings = make(map[string]*session.Sharding)
+		}
+		e.shardings[table.Name] = &sharding
+	}
+	return nil
+}
+
+// openDBs connects the databases with the same driver and pool settings of primary database, the connected ones
+// are closed on error
+func (e *Engine) openDBs(driver string, dataSources []string) (dbs []*sql.DB, err error) {
+	for _, dataSource := range dataSources {
+		db, err := sql.Open(driver, e.dialect.DataSource(dataSource))
+		if err == nil {
+			err = db.Ping()
+		}
+		if err != nil {
+			if db != nil {
+				_ = db.Close()
+			}
+			for _, opened := range dbs {
+				_ = opened.Close()
+			}
+			return nil, ormlog.New(fmt.Sprintf("failed to connect %s: %v", dataSource, err))
+		}
+		e.tune(db)
+		dbs = append(dbs, db)
 	}
-	e = &Engine{db: db, dialect: dial}
-	ormlog.Info("database connected")
 	return
 }
 
 func (e *Engine) Close() (err error) {
+	if e.stmts != nil {
+		_ = e.stmts.Close()
+	}
+	if e.replicas != nil {
+		_ = e.replicas.Close()
+	}
+	for _, sharding := range e.shardings {
+		for _, db := range sharding.DBs {
+			_ = db.Close()
+		}
+	}
 	err = e.db.Close()
 	return
 }
 
+// Stats returns the connection pool statistics of the primary database
+func (e *Engine) Stats() sql.DBStats {
+	return e.db.Stats()
+}
+
+// Ping checks the connections of the primary database, the replicas and the shards, it is used for health checks
+func (e *Engine) Ping(ctx context.Context) (err error) {
+	if err = e.db.PingContext(ctx); err != nil {
+		return
+	}
+	if e.replicas != nil {
+		if err = e.replicas.Ping(ctx); err != nil {
+			return
+		}
+	}
+	for table, sharding := range e.shardings {
+		for i, db := range sharding.DBs {
+			if err = db.PingContext(ctx); err != nil {
+				return ormlog.New(fmt.Sprintf("failed to ping shard %d of table %s: %v", i, table, err))
+			}
+		}
+	}
+	return
+}
+
+// Logger returns the logger of engine, it is ormlog.Default unless WithLogger is given
+func (e *Engine) Logger() ormlog.Logger {
+	return e.logger
+}
+
 func (e *Engine) NewSession() (s *session.Session) {
-	return session.New(e.db, e.dialect)
+	return session.New(e.db, e.dialect).SchemaCache(e.schemas, e.naming).StmtCache(e.stmts).Cache(e.cache).
+		Replicas(e.replicas).Shardings(e.shardings).Logger(e.logger).SlowThreshold(e.slow).
+		Instrumentation(e.instrumentation)
 }
 
-type TxFunc func(*session.Session) (interface{}, error)
+// Model is a shortcut of NewSession().Model(v), the returned session can be reused as a base query
+func (e *Engine) Model(v interface{}) (s *session.Session) {
+	return e.NewSession().Model(v)
+}
+
+// Where is a shortcut of NewSession().Where(desc, args...)
+func (e *Engine) Where(desc string, args ...interface{}) (s *session.Session) {
+	return e.NewSession().Where(desc, args...)
+}
+
+// Raw is a shortcut of NewSession().Raw(sql, values...)
+func (e *Engine) Raw(sql string, values ...interface{}) (s *session.Session) {
+	return e.NewSession().Raw(sql, values...)
+}
+
+type TxFunc = session.TxFunc
 
 /*
 Transaction is a convenient method to do a transaction.
@@ -57,89 +268,59 @@ Transaction is a convenient method to do a transaction.
 		return
 	}
 
-	And then, we can use RecreateAndInsert as the callback func of Transaction
+	And then, we can use RecreateAndInsert as the callback func of Transaction.
+	The nested calls of Session.Transaction inside f are run in savepoints of this transaction.
 */
 func (e *Engine) Transaction(f TxFunc) (result interface{}, err error) {
-	s := e.NewSession()
-	if err = s.Begin(); err != nil {
-		return
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			_ = s.Rollback()
-			panic(p) // re-throw the panic after rollback
-		} else if err != nil {
-			_ = s.Rollback() // err is not nil, just rollback
-		} else {
-			err = s.Commit() // err is nil, commit and update err
-		}
-	}()
+	return e.NewSession().Transaction(f)
+}
 
-	return f(s)
+// TxOptions are the options of Engine.TransactionWithOptions
+type TxOptions struct {
+	Isolation sql.IsolationLevel // the isolation level of transaction, zero means the default level of driver
+	ReadOnly  bool
+	Retry     *RetryPolicy // re-run the transaction on retryable errors, nil means no retry
 }
 
-// Migrate only supports the column`s add and delete
-func (e *Engine) Migrate(value interface{}) (err error) {
-	_, err = e.Transaction(func(s *session.Session) (result interface{}, err error) {
-		// if table not exist, then try to create it
-		exists, err := s.Model(value).TableExists()
-		if err != nil {
-			return
-		}
-		if !exists {
-			return nil, s.CreateTable()
-		}
+// RetryPolicy re-runs the whole TxFunc in a new transaction when it fails with an error that the dialect
+// considers retryable, like SQLITE_BUSY
+type RetryPolicy struct {
+	MaxAttempts int           // the max number of attempts including the first one
+	Backoff     time.Duration // the wait before the first retry, it doubles after each retry
+	MaxBackoff  time.Duration // the upper bound of the wait, zero means no bound
+}
 
-		// if table exist, then try to migrate it
-		table, err := s.RefTable()
-		if err != nil {
-			return
-		}
-		rows, err := s.Raw(fmt.Sprintf("SELECT * FROM %s LIMIT 1", table.Name)).QueryRows()
-		if err != nil {
-			return
-		}
-		oldFields, err := rows.Columns()
-		if err != nil {
-			return
-		}
-		// get new columns and columns to be deleted
-		newFields := difference(table.FieldNames, oldFields)
-		deletedFields := difference(oldFields, table.FieldNames)
-		ormlog.Infof("table '%s' migrate: new cols %v, deleted cols %v", table.Name, newFields, deletedFields)
-		// add the new fields
-		for _, field := range newFields {
-			f := table.GetField(field)
-			alterSql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s %s", table.Name, f.Name, f.Type, f.Constraints)
-			if _, err = s.Raw(alterSql).Exec(); err != nil {
-				return
-			}
-		}
-		if len(deletedFields) == 0 {
-			return
-		}
-		// migrate by sql
-		tmpTable := "tmp_" + table.Name
-		fieldStr := strings.Join(table.FieldNames, ", ")
-		s.Raw(fmt.Sprintf("CREATE TABLE %s AS SELECT %s FROM %s;", tmpTable, fieldStr, table.Name))
-		s.Raw(fmt.Sprintf("DROP TABLE %s", table.Name))
-		s.Raw(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmpTable, table.Name))
-		_, err = s.Exec()
-		return
-	})
+// DefaultRetryPolicy retries twice with 10ms and 20ms wait
+var DefaultRetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}
+
+// wait returns the backoff before the given retry, the first retry is 1
+func (p *RetryPolicy) wait(retry int) (d time.Duration) {
+	d = p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
 	return
 }
 
-// difference returns element in array a and not in array b.In short, it returns (a - b)
-func difference(a, b []string) (diff []string) {
-	mapB := make(map[string]struct{})
-	for _, e := range b {
-		mapB[e] = struct{}{}
-	}
-	for _, e := range a {
-		if _, ok := mapB[e]; !ok {
-			diff = append(diff, e)
+// TransactionWithOptions is the same as Transaction, but the transaction begins with the isolation level and
+// read-only flag of opts, and f is re-run in a new transaction by opts.Retry if it fails with a retryable error
+//  NOTES: f may be called several times, so it should not have side effects except the DB operation in session
+func (e *Engine) TransactionWithOptions(ctx context.Context, opts TxOptions, f TxFunc) (result interface{}, err error) {
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	for attempt := 1; ; attempt++ {
+		result, err = e.NewSession().TransactionTx(ctx, txOpts, f)
+		if err == nil || opts.Retry == nil || attempt >= opts.Retry.MaxAttempts || !e.dialect.IsRetryableError(err) {
+			return
+		}
+		wait := opts.Retry.wait(attempt)
+		e.logger.Warnf("transaction attempt %d failed, retry after %v, err: %v", attempt, wait, err)
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(wait):
 		}
 	}
-	return
 }
@@ -1,11 +1,14 @@
 package miniorm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
 	"miniorm/session"
 )
@@ -33,6 +36,35 @@ func TestEngine_Transaction(t *testing.T) {
 	})
 }
 
+func TestEngine_TransactionWithOptions(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	opts := TxOptions{
+		Isolation: sql.LevelSerializable,
+		Retry:     &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+	}
+
+	attempts := 0
+	_, err := engine.TransactionWithOptions(context.Background(), opts, func(s *session.Session) (interface{}, error) {
+		if attempts++; attempts < 3 {
+			return nil, sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		return nil, nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("failed to retry the busy transaction, attempts: %d, err: %v", attempts, err)
+	}
+
+	attempts = 0
+	_, err = engine.TransactionWithOptions(context.Background(), opts, func(s *session.Session) (interface{}, error) {
+		attempts++
+		return nil, errors.New("fake error")
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("expected no retry for the fake error, attempts: %d, err: %v", attempts, err)
+	}
+}
+
 func TestEngine_Migrate(t *testing.T) {
 	// t.Run("commit", func(t *testing.T) {
 	// 	transactionCommit(t)
@@ -40,6 +72,9 @@ func TestEngine_Migrate(t *testing.T) {
 	t.Run("migrate", func(t *testing.T) {
 		transactionMigrate(t)
 	})
+	t.Run("rebuild", func(t *testing.T) {
+		migrateRebuild(t)
+	})
 }
 
 type User struct {
@@ -58,6 +93,161 @@ func transactionMigrate(t *testing.T) {
 	}
 }
 
+func migrateRebuild(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS User;").Exec()
+	// Age changes to NOT NULL, Grade is added, and Password is deleted
+	_, _ = s.Raw("CREATE TABLE User(Name text PRIMARY KEY, Age integer, HomeAddr text, Password text);").Exec()
+	if _, err := s.Raw("INSERT INTO User VALUES (?, ?, ?, ?)", "Tom", 18, "Mars", "secret").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Migrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := s.Model(&User{}).ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, column := range columns {
+		names = append(names, column.Name)
+		if column.Name == "Age" && (column.Nullable || column.Default.String != "0") {
+			t.Fatalf("failed to change the column Age, column: %+v", column)
+		}
+	}
+	if strings.Join(names, ",") != "Name,Age,HomeAddr,Grade" {
+		t.Fatalf("failed to migrate the columns of User, columns: %v", names)
+	}
+	u := &User{}
+	if err = s.First(u); err != nil || u.Name != "Tom" || u.Age != 18 || u.HomeAddr != "Mars" {
+		t.Fatalf("failed to keep the data after migrate, user: %v, err: %v", u, err)
+	}
+}
+
+func TestEngine_MigratePlan(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS User;").Exec()
+	_, _ = s.Raw("CREATE TABLE User(Name text PRIMARY KEY, Age integer NOT NULL DEFAULT 0, HomeAddr text);").Exec()
+
+	plan, err := engine.MigratePlan(&User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Destructive || plan[0].SQL != `ALTER TABLE "User" ADD COLUMN "Grade" integer NOT NULL DEFAULT 0` {
+		t.Fatalf("failed to plan the column adding, plan: %v", plan)
+	}
+
+	_, _ = s.Raw("ALTER TABLE User ADD COLUMN Password text").Exec()
+	if plan, err = engine.MigratePlan(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 4 || !plan[2].Destructive || plan[2].SQL != `DROP TABLE "User"` {
+		t.Fatalf("failed to plan the table rebuilding, plan: %v", plan)
+	}
+	// the plan is not executed
+	columns, err := s.Model(&User{}).ColumnTypes()
+	if err != nil || len(columns) != 4 || columns[3].Name != "Password" {
+		t.Fatalf("the plan should not change the table, columns: %v, err: %v", columns, err)
+	}
+}
+
+type Member struct {
+	Id    int    `miniorm:"PRIMARY KEY"`
+	Name  string `miniorm:"index:idx_member_name_age"`
+	Age   int    `miniorm:"index:idx_member_name_age"`
+	Email string `miniorm:"uniqueIndex"`
+}
+
+func TestEngine_MigrateIndexes(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	s := engine.NewSession()
+	_, _ = s.Raw("DROP TABLE IF EXISTS Member;").Exec()
+	_, _ = s.Raw("CREATE TABLE Member(Id integer PRIMARY KEY, Name text, Age integer, Email text);").Exec()
+	_, _ = s.Raw("CREATE INDEX idx_member_name_age ON Member (Name);").Exec()
+	_, _ = s.Raw("CREATE INDEX idx_member_stale ON Member (Age);").Exec()
+
+	plan, err := engine.MigratePlan(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sqls []string
+	for _, step := range plan {
+		sqls = append(sqls, step.SQL)
+	}
+	expected := []string{
+		`DROP INDEX "idx_member_name_age"`,
+		`DROP INDEX "idx_member_stale"`,
+		`CREATE INDEX "idx_member_name_age" ON "Member" ("Name", "Age")`,
+		`CREATE UNIQUE INDEX "idx_Member_Email" ON "Member" ("Email")`,
+	}
+	if strings.Join(sqls, ";") != strings.Join(expected, ";") {
+		t.Fatalf("failed to plan the index migration, plan: %v", sqls)
+	}
+	if err = engine.Migrate(&Member{}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = engine.MigratePlan(&Member{}); err != nil || len(plan) != 0 {
+		t.Fatalf("expected no steps after migrate, plan: %v, err: %v", plan, err)
+	}
+}
+
+type Team struct {
+	Id   int `miniorm:"PRIMARY KEY"`
+	Name string
+}
+
+type Player struct {
+	Id     int `miniorm:"PRIMARY KEY"`
+	TeamId int
+	Team   *Team `miniorm:"foreignKey:TeamId;references:Id;onDelete:CASCADE"`
+}
+
+func TestEngine_AutoMigrate(t *testing.T) {
+	engine := openDB(t)
+	defer engine.Close()
+	if err := engine.DropTables(&Player{}, &Team{}); err != nil {
+		t.Fatal(err)
+	}
+	// the referenced table Team is created first
+	if err := engine.AutoMigrate(&Player{}, &Team{}); err != nil {
+		t.Fatal(err)
+	}
+	s := engine.NewSession()
+	if _, err := s.Insert(&Player{Id: 1, TeamId: 1}); err == nil {
+		t.Fatal("expected foreign key error when insert player without team")
+	}
+	_, err1 := s.Insert(&Team{Id: 1, Name: "Red"})
+	_, err2 := s.Insert(&Player{Id: 1, TeamId: 1})
+	if err1 != nil || err2 != nil {
+		t.Fatalf("failed to insert records, team-err: %v, player-err: %v", err1, err2)
+	}
+
+	// rebuilding the referenced table does not delete the players by cascade
+	_, _ = s.Raw("ALTER TABLE Team ADD COLUMN Stale text").Exec()
+	if err := engine.AutoMigrate(&Player{}, &Team{}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := s.Model(&Player{}).Count(); err != nil || count != 1 {
+		t.Fatalf("failed to keep players after rebuilding team, count: %d, err: %v", count, err)
+	}
+	if _, err := s.Model(&Team{}).Where("Id = ?", 1).Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := s.Model(&Player{}).Count(); err != nil || count != 0 {
+		t.Fatalf("failed to delete players by cascade, count: %d, err: %v", count, err)
+	}
+
+	if err := engine.DropTables(&Team{}, &Player{}); err != nil {
+		t.Fatalf("failed to drop tables in reverse order, err: %v", err)
+	}
+}
+
 func transactionCommit(t *testing.T) {
 	engine := openDB(t)
 	defer engine.Close()
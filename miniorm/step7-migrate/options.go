@@ -0,0 +1,122 @@
+package miniorm
+
+import (
+	"time"
+
+	"miniorm/cache"
+	"miniorm/instrument"
+	"miniorm/ormlog"
+	"miniorm/schema"
+	"miniorm/session"
+)
+
+// Option configures the Engine in NewEngine and NewEngineFromDB, the options are applied before the database
+// connected, and the settings of database like the pool limits are applied after it
+type Option func(e *Engine)
+
+// WithStmtCache makes the sessions run the statements by the prepared statements, at most capacity statements
+// are cached by LRU, and they are closed on eviction and Engine.Close
+func WithStmtCache(capacity int) Option {
+	return func(e *Engine) {
+		e.stmtCacheSize = capacity
+	}
+}
+
+// WithCache makes the sessions cache the results of Find, First and Count in c, like cache.NewLRU(1000, time.Minute)
+//  the cache is bypassed in transaction and by Session.NoCache
+func WithCache(c cache.Cache) Option {
+	return func(e *Engine) {
+		e.cache = c
+	}
+}
+
+// WithReplicas makes the read statements of sessions run on the replicas connected by dataSources, the replicas
+// use the same driver as the primary database, and they are picked in turn unless WithReplicaPolicy is given
+//  the writes and transactions always run on the primary database, use Session.Primary to read the data just
+//  written
+func WithReplicas(dataSources ...string) Option {
+	return func(e *Engine) {
+		e.replicaSources = append(e.replicaSources, dataSources...)
+	}
+}
+
+// WithReplicaPolicy sets how the replica of a read statement is picked, session.RoundRobin by default
+func WithReplicaPolicy(policy session.ReplicaPolicy) Option {
+	return func(e *Engine) {
+		e.replicaPolicy = policy
+	}
+}
+
+// WithSharding splits the table of model into shards by the shard key column of sharding, see session.Sharding,
+// the shards are the databases connected by dataSources with the same driver if they are given, otherwise the
+// tables with suffix like "Order_1" in the primary database, which are created by Session.Shard
+func WithSharding(model interface{}, sharding session.Sharding, dataSources ...string) Option {
+	return func(e *Engine) {
+		e.shardingConfigs = append(e.shardingConfigs, shardingConfig{model: model, sharding: sharding, dataSources: dataSources})
+	}
+}
+
+// WithMaxOpenConns sets the max number of open connections of the databases, zero means no limit
+func WithMaxOpenConns(n int) Option {
+	return func(e *Engine) {
+		e.maxOpenConns = n
+	}
+}
+
+// WithConnMaxLifetime sets the max time a connection of the databases may be reused, zero means forever
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(e *Engine) {
+		e.connMaxLifetime = d
+	}
+}
+
+// WithLogger makes the engine and its sessions write the logs to logger instead of the global loggers of ormlog,
+// like ormlog.NewJSONLogger(os.Stderr, ormlog.InfoLevel), the logger of a session can be changed by Session.Logger
+func WithLogger(logger ormlog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithSlowThreshold makes the statements taking longer than threshold logged at WARN, it is
+// session.DefaultSlowThreshold by default, and zero means no statement is slow
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(e *Engine) {
+		e.slow = threshold
+	}
+}
+
+// WithNamingStrategy makes the engine map the names of structs and fields to tables and columns by naming, like
+// schema.SnakeNamingStrategy{}, the naming must be comparable because the parsed schemas are cached by it
+func WithNamingStrategy(naming schema.NamingStrategy) Option {
+	return func(e *Engine) {
+		e.naming = naming
+	}
+}
+
+// WithDialect makes NewEngine use the dialect registered by name instead of the driver name, it is used with the
+// driver registered by other name, like "sqlite" of modernc.org/sqlite with the dialect "sqlite3"
+//  NOTES: the dialect "sqlite3" enables the foreign keys by the parameter "_foreign_keys" of go-sqlite3 which is
+//  ignored by other drivers, so enable them in the data source of the driver, like "?_pragma=foreign_keys(1)" of
+//  modernc.org/sqlite
+func WithDialect(name string) Option {
+	return func(e *Engine) {
+		e.dialectName = name
+	}
+}
+
+// WithInstrumentation makes the statements and transactions of sessions observed by instrumentation, like
+// instrument.NewMetrics() for the latency histograms, or an adapter of tracing SDK
+func WithInstrumentation(instrumentation instrument.Instrumentation) Option {
+	return func(e *Engine) {
+		e.instrumentation = instrumentation
+	}
+}
+
+// StmtCacheStats returns the hits and misses of the prepared statement cache, it is zero if the cache is disabled
+func (e *Engine) StmtCacheStats() (stats session.StmtCacheStats) {
+	if e.stmts != nil {
+		stats = e.stmts.Stats()
+	}
+	return
+}
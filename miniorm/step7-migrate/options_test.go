@@ -0,0 +1,303 @@
+package miniorm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"miniorm/instrument"
+	"miniorm/ormlog"
+	"miniorm/schema"
+	"miniorm/session"
+)
+
+func TestWithStmtCache(t *testing.T) {
+	engine, err := NewEngine("sqlite3", "./gee.db", WithStmtCache(16))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.Model(&User{})
+	if err1, err2 := s.DropTable(), s.CreateTable(); err1 != nil || err2 != nil {
+		t.Fatalf("failed to create table, drop-table-err: %v, create-table-err: %v", err1, err2)
+	}
+	// the statement prepared out of transaction is used in transaction
+	if _, err = s.Insert(&User{Name: "A", Age: 18}); err != nil {
+		t.Fatal("failed to insert", err)
+	}
+	_, err = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		for i := 1; i < 3; i++ {
+			if _, err = s.Insert(&User{Name: string(rune('A' + i)), Age: 18}); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal("failed to insert in transaction", err)
+	}
+	if count, err := s.Count(); err != nil || count != 3 {
+		t.Fatalf("expect 3 users, but got %d, err: %v", count, err)
+	}
+	if stats := engine.StmtCacheStats(); stats.Hits < 2 || stats.Misses == 0 {
+		t.Fatalf("the statements should be cached, stats: %+v", stats)
+	}
+
+	// the transaction holding the only connection does not prepare the statements on pool
+	engine, err = NewEngine("sqlite3", filepath.Join(t.TempDir(), "conns.db"), WithStmtCache(16), WithMaxOpenConns(1))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	if err = engine.Model(&User{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+			_, err = s.Model(&User{}).Insert(&User{Name: "A", Age: 18})
+			return
+		})
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal("failed to insert in transaction", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the transaction is blocked by preparing the statement on pool")
+	}
+}
+
+func TestWithReplicas(t *testing.T) {
+	dir := t.TempDir()
+	sources := []string{filepath.Join(dir, "primary.db"), filepath.Join(dir, "r1.db"), filepath.Join(dir, "r2.db")}
+	// each database has a different user to tell where the read runs on
+	for i, source := range sources {
+		engine, err := NewEngine("sqlite3", source)
+		if err != nil {
+			t.Fatal("failed to connect", err)
+		}
+		s := engine.Model(&User{})
+		if err = s.CreateTable(); err == nil {
+			_, err = s.Insert(&User{Name: string(rune('A' + i)), Age: 18})
+		}
+		_ = engine.Close()
+		if err != nil {
+			t.Fatal("failed to prepare database", err)
+		}
+	}
+
+	engine, err := NewEngine("sqlite3", sources[0], WithReplicas(sources[1:]...))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.Model(&User{})
+	var names []string
+	for i := 0; i < 4; i++ {
+		u := &User{}
+		if err = s.First(u); err != nil {
+			t.Fatal("failed to read from replica", err)
+		}
+		names = append(names, u.Name)
+	}
+	if names[0] == "A" || names[0] == names[1] || names[0] != names[2] || names[1] != names[3] {
+		t.Fatalf("the reads should run on replicas in turn, got %v", names)
+	}
+
+	if _, err = s.Insert(&User{Name: "D", Age: 20}); err != nil {
+		t.Fatal("failed to insert", err)
+	}
+	if count, err := s.Primary().Count(); err != nil || count != 2 {
+		t.Fatalf("the write should run on primary, count: %d, err: %v", count, err)
+	}
+	if count, err := s.Count(); err != nil || count != 1 {
+		t.Fatalf("the replica should not be written, count: %d, err: %v", count, err)
+	}
+	_, err = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		if count, _ := s.Model(&User{}).Count(); count != 2 {
+			t.Fatalf("the reads in transaction should run on primary, count: %d", count)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewEngine("sqlite3", sources[0], WithReplicas(filepath.Join(dir, "missing", "r.db"))); err == nil {
+		t.Fatal("expect error when the replica can not be connected")
+	}
+}
+
+type Order struct {
+	Id     int `miniorm:"PRIMARY KEY"`
+	UserId int
+}
+
+func TestWithSharding(t *testing.T) {
+	dir := t.TempDir()
+	sources := []string{filepath.Join(dir, "s0.db"), filepath.Join(dir, "s1.db")}
+	sharding := session.Sharding{Column: "UserId", ShardFunc: func(key interface{}) (int, error) {
+		return key.(int) % 2, nil
+	}}
+	engine, err := NewEngine("sqlite3", filepath.Join(dir, "primary.db"), WithSharding(&Order{}, sharding, sources...))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.Model(&Order{})
+	for i := range sources {
+		if err = s.Shard(i).CreateTable(); err != nil {
+			t.Fatal("failed to create table of shard", err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err = s.Insert(&Order{Id: i, UserId: i}); err != nil {
+			t.Fatal("failed to insert", err)
+		}
+	}
+	if count, err := s.Where("UserId = ?", 1).Count(); err != nil || count != 1 {
+		t.Fatalf("failed to count by shard key, count: %d, err: %v", count, err)
+	}
+	if count, err := s.Shard(1).Count(); err != nil || count != 2 {
+		t.Fatalf("the odd users should be in the second database, count: %d, err: %v", count, err)
+	}
+	if exist, _ := s.TableExists(); exist {
+		t.Fatal("the sharded table should not be in the primary database")
+	}
+	var orders []Order
+	if err = s.Scatter().Find(&orders); err != nil || len(orders) != 3 {
+		t.Fatalf("failed to find orders on all shards, orders: %v, err: %v", orders, err)
+	}
+	if err = s.Find(&orders); err == nil {
+		t.Fatal("expect error when the shard key is not given")
+	}
+	_, err = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		return s.Insert(&Order{Id: 4, UserId: 4})
+	})
+	if err == nil {
+		t.Fatal("expect error when the shards in different databases are written in transaction")
+	}
+}
+
+type recordLogger struct {
+	logs []string
+}
+
+func (l *recordLogger) Debugf(format string, v ...interface{}) { l.log("DEBUG", format, v...) }
+func (l *recordLogger) Infof(format string, v ...interface{})  { l.log("INFO", format, v...) }
+func (l *recordLogger) Warnf(format string, v ...interface{})  { l.log("WARN", format, v...) }
+func (l *recordLogger) Errorf(format string, v ...interface{}) { l.log("ERROR", format, v...) }
+func (l *recordLogger) Trace(event ormlog.TraceEvent)          { l.log("TRACE", "%v", event) }
+
+func (l *recordLogger) log(level, format string, v ...interface{}) {
+	l.logs = append(l.logs, level+" "+fmt.Sprintf(format, v...))
+}
+
+func TestNewEngineFromDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "gee.db"))
+	if err != nil {
+		t.Fatal("failed to open db", err)
+	}
+	logger := &recordLogger{}
+	engine, err := NewEngineFromDB(db, "sqlite3", WithMaxOpenConns(2), WithConnMaxLifetime(time.Minute),
+		WithLogger(logger), WithNamingStrategy(schema.SnakeNamingStrategy{}))
+	if err != nil {
+		t.Fatal("failed to create engine", err)
+	}
+	defer engine.Close()
+	if err = engine.Ping(context.Background()); err != nil {
+		t.Fatal("failed to ping", err)
+	}
+	if stats := engine.Stats(); stats.MaxOpenConnections != 2 {
+		t.Fatalf("the pool should be limited, stats: %+v", stats)
+	}
+
+	s := engine.Model(&User{})
+	if err = s.CreateTable(); err != nil {
+		t.Fatal("failed to create table", err)
+	}
+	if exist, _ := engine.NewSession().Model(&User{}).TableExists(); !exist || s.RefTableName() != "user" {
+		t.Fatalf("the table should be named by the naming strategy, got %s", s.RefTableName())
+	}
+	if len(logger.logs) == 0 || !strings.Contains(strings.Join(logger.logs, "\n"), `CREATE TABLE "user"`) {
+		t.Fatalf("the statements should be logged by the logger of engine, logs: %v", logger.logs)
+	}
+
+	if _, err = NewEngineFromDB(db, "unknown"); err == nil {
+		t.Fatal("expect error when the dialect is not registered")
+	}
+	if _, err = NewEngine("sqlite3", filepath.Join(t.TempDir(), "gee.db"), WithDialect("unknown")); err == nil {
+		t.Fatal("expect error when the dialect given by WithDialect is not registered")
+	}
+}
+
+func TestWithSlowThreshold(t *testing.T) {
+	var buf bytes.Buffer
+	engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), "gee.db"),
+		WithLogger(ormlog.NewTextLogger(&buf, ormlog.WarnLevel)), WithSlowThreshold(time.Nanosecond))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	if err = engine.Model(&User{}).CreateTable(); err != nil {
+		t.Fatal("failed to create table", err)
+	}
+	if logs := buf.String(); !strings.Contains(logs, "WARN SLOW CREATE TABLE") {
+		t.Fatalf("the slow statement should be logged at WARN, logs: %q", logs)
+	}
+
+	buf.Reset()
+	s := engine.NewSession().SlowThreshold(0)
+	if _, err = s.Raw("SELECT 1").Exec(); err != nil || buf.Len() != 0 {
+		t.Fatalf("no statement should be slow without threshold, logs: %q, err: %v", buf.String(), err)
+	}
+	if _, err = s.Raw("SELECT * FROM NotExist").Exec(); err == nil || !strings.Contains(buf.String(), "ERROR SELECT") {
+		t.Fatalf("the failed statement should be logged at ERROR, logs: %q, err: %v", buf.String(), err)
+	}
+}
+
+type recordInstrumentation struct {
+	started, finished []string
+}
+
+func (r *recordInstrumentation) Start(event *instrument.Event) {
+	event.Value = len(r.started)
+	r.started = append(r.started, event.Table+" "+event.Operation)
+}
+
+func (r *recordInstrumentation) Finish(event *instrument.Event) {
+	r.finished = append(r.finished, fmt.Sprintf("%d %s %s %v", event.Value, event.Table, event.Operation, event.Err != nil))
+}
+
+func TestWithInstrumentation(t *testing.T) {
+	r := &recordInstrumentation{}
+	engine, err := NewEngine("sqlite3", filepath.Join(t.TempDir(), "gee.db"), WithInstrumentation(r))
+	if err != nil {
+		t.Fatal("failed to connect", err)
+	}
+	defer engine.Close()
+	s := engine.Model(&User{})
+	if err = s.CreateTable(); err != nil {
+		t.Fatal("failed to create table", err)
+	}
+	_, _ = engine.Transaction(func(s *session.Session) (result interface{}, err error) {
+		return s.Insert(&User{Name: "Tom"}, &User{Name: "Tom"})
+	})
+	var users []User
+	if err = s.Find(&users); err != nil {
+		t.Fatal("failed to find", err)
+	}
+
+	expect := []string{"0 User create false", "2 User insert true", "1  rollback false", "3 User select false"}
+	if fmt.Sprint(r.finished) != fmt.Sprint(expect) || len(r.started) != len(expect) || r.started[1] != " transaction" {
+		t.Fatalf("expect finished %v, got %v, started %v", expect, r.finished, r.started)
+	}
+}
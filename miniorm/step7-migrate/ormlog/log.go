@@ -12,7 +12,7 @@ var (
 	warnLog  = log.New(os.Stdout, "\033[33m[WARN]\033[0m ", log.Ldate|log.Ltime|log.LstdFlags|log.Lshortfile)
 	infoLog  = log.New(os.Stdout, "\033[32m[INFO]\033[0m ", log.Ldate|log.Ltime|log.LstdFlags|log.Lshortfile)
 	debugLog = log.New(os.Stdout, "\033[34m[DEBUG]\033[0m ", log.Ldate|log.Ltime|log.LstdFlags|log.Lshortfile)
-	loggers  = []*log.Logger{errLog, infoLog}
+	loggers  = []*log.Logger{errLog, warnLog, infoLog, debugLog}
 	mu       sync.Mutex
 )
 
@@ -60,7 +60,7 @@ func SetLevel(level int) {
 		warnLog.SetOutput(io.Discard)
 	}
 	if level > ErrorLevel {
-		warnLog.SetOutput(io.Discard)
+		errLog.SetOutput(io.Discard)
 	}
 }
 
@@ -1,6 +1,13 @@
 package ormlog
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
 	"testing"
 	"time"
 )
@@ -12,3 +19,66 @@ func TestSetLevel(t *testing.T) {
 	Warnf("print log @ %s", time.Now())
 	Errorf("print log @ %s", time.Now())
 }
+
+func TestSetLevel_Discard(t *testing.T) {
+	defer SetLevel(DebugLevel)
+	SetLevel(ErrorLevel)
+	if errLog.Writer() == io.Discard || warnLog.Writer() != io.Discard || debugLog.Writer() != io.Discard {
+		t.Fatal("only the error logger should write at ErrorLevel")
+	}
+	SetLevel(Disabled)
+	if errLog.Writer() != io.Discard {
+		t.Fatal("the error logger should be discarded when disabled")
+	}
+	SetLevel(DebugLevel)
+	for _, logger := range []*log.Logger{errLog, warnLog, infoLog, debugLog} {
+		if logger.Writer() == io.Discard {
+			t.Fatalf("logger %q should write at DebugLevel", logger.Prefix())
+		}
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewTextLogger(&buf, InfoLevel)
+	logger.Debugf("hidden")
+	logger.Infof("connected to %s", "gee.db")
+	logger.Trace(TraceEvent{SQL: "SELECT * FROM User WHERE Age > ?", Vars: []interface{}{18}, Rows: -1})
+	logger.Trace(TraceEvent{SQL: "DELETE FROM User", Duration: time.Second, Rows: 2, Slow: true})
+	logger.Trace(TraceEvent{SQL: "SELECT\n*", Rows: -1, Err: errors.New("syntax error")})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %q", lines)
+	}
+	for i, suffix := range []string{"INFO connected to gee.db", "WARN SLOW DELETE FROM User [] 1s rows:2",
+		"ERROR SELECT * [] 0s rows:-1 err: syntax error"} {
+		if !strings.HasSuffix(lines[i], suffix) {
+			t.Fatalf("expect line %d ends with %q, got %q", i, suffix, lines[i])
+		}
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLogger(&buf, DebugLevel)
+	logger.Warnf("retry %d", 1)
+	logger.Trace(TraceEvent{SQL: "UPDATE User SET Age = ?", Vars: []interface{}{18}, Duration: 1500 * time.Microsecond,
+		Rows: 1, Err: errors.New("locked")})
+
+	dec := json.NewDecoder(&buf)
+	var warn, trace map[string]interface{}
+	if err := dec.Decode(&warn); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&trace); err != nil {
+		t.Fatal(err)
+	}
+	if warn["level"] != "WARN" || warn["msg"] != "retry 1" || warn["sql"] != nil {
+		t.Fatalf("unexpected log: %v", warn)
+	}
+	if trace["level"] != "ERROR" || trace["sql"] != "UPDATE User SET Age = ?" || trace["duration_ms"] != 1.5 ||
+		trace["rows"] != 1.0 || trace["error"] != "locked" || fmt.Sprint(trace["vars"]) != "[18]" {
+		t.Fatalf("unexpected trace: %v", trace)
+	}
+}
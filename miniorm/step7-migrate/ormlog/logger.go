@@ -0,0 +1,84 @@
+package ormlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Logger is the leveled logger of Engine and Session, it is set by miniorm.WithLogger or Session.Logger
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+	// Trace logs the statement run by session, usually at DEBUG, or at WARN if it is slow and at ERROR if it fails
+	Trace(event TraceEvent)
+}
+
+// TraceEvent is the statement run by session
+type TraceEvent struct {
+	SQL      string
+	Vars     []interface{}
+	Duration time.Duration
+	Rows     int64 // the rows affected by the statement, -1 for the query
+	Err      error
+	Slow     bool // the duration reaches the slow threshold of session
+}
+
+// Level returns the level to log the event at
+func (e TraceEvent) Level() int {
+	switch {
+	case e.Err != nil:
+		return ErrorLevel
+	case e.Slow:
+		return WarnLevel
+	}
+	return DebugLevel
+}
+
+// String returns the text of event like "SELECT * FROM User WHERE Age > ? [18] 1.2ms rows:-1"
+func (e TraceEvent) String() string {
+	text := fmt.Sprintf("%s %v %v rows:%d", e.SQL, e.Vars, e.Duration, e.Rows)
+	if e.Slow {
+		text = "SLOW " + text
+	}
+	if e.Err != nil {
+		text += fmt.Sprintf(" err: %v", e.Err)
+	}
+	return text
+}
+
+// Default writes the logs to the global loggers of package, its level is set by SetLevel
+var Default Logger = globalLogger{}
+
+type globalLogger struct{}
+
+// calldepth makes the global loggers report the file and line of the caller of Logger
+const calldepth = 3
+
+func (globalLogger) Debugf(format string, v ...interface{}) {
+	_ = debugLog.Output(calldepth, fmt.Sprintf(format, v...))
+}
+
+func (globalLogger) Infof(format string, v ...interface{}) {
+	_ = infoLog.Output(calldepth, fmt.Sprintf(format, v...))
+}
+
+func (globalLogger) Warnf(format string, v ...interface{}) {
+	_ = warnLog.Output(calldepth, fmt.Sprintf(format, v...))
+}
+
+func (globalLogger) Errorf(format string, v ...interface{}) {
+	_ = errLog.Output(calldepth, fmt.Sprintf(format, v...))
+}
+
+func (globalLogger) Trace(event TraceEvent) {
+	switch event.Level() {
+	case ErrorLevel:
+		_ = errLog.Output(calldepth, event.String())
+	case WarnLevel:
+		_ = warnLog.Output(calldepth, event.String())
+	default:
+		_ = debugLog.Output(calldepth, event.String())
+	}
+}
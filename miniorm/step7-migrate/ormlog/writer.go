@@ -0,0 +1,116 @@
+package ormlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var levelNames = map[int]string{DebugLevel: "DEBUG", InfoLevel: "INFO", WarnLevel: "WARN", ErrorLevel: "ERROR"}
+
+// writerLogger writes the logs at or above level to w, the format of log is given by encode
+type writerLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  int
+	encode func(entry logEntry) []byte
+}
+
+type logEntry struct {
+	time  time.Time
+	level int
+	msg   string
+	event *TraceEvent // nil means the log is not a trace event
+}
+
+// NewTextLogger returns a Logger writing the logs at or above level to w in plain text, one log per line, like:
+//  2006-01-02T15:04:05.000Z07:00 DEBUG SELECT * FROM User WHERE Age > ? [18] 1.2ms rows:-1
+func NewTextLogger(w io.Writer, level int) Logger {
+	return &writerLogger{w: w, level: level, encode: encodeText}
+}
+
+// NewJSONLogger returns a Logger writing the logs at or above level to w in JSON, one object per line, like:
+//  {"time":"...","level":"DEBUG","msg":"...","sql":"...","vars":[18],"duration_ms":1.2,"rows":-1,"error":""}
+//  the fields of trace event are omitted for the other logs
+func NewJSONLogger(w io.Writer, level int) Logger {
+	return &writerLogger{w: w, level: level, encode: encodeJSON}
+}
+
+func (l *writerLogger) Debugf(format string, v ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *writerLogger) Infof(format string, v ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *writerLogger) Warnf(format string, v ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *writerLogger) Errorf(format string, v ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *writerLogger) Trace(event TraceEvent) {
+	msg := "statement"
+	if event.Slow {
+		msg = "slow statement"
+	}
+	l.log(event.Level(), msg, &event)
+}
+
+func (l *writerLogger) log(level int, msg string, event *TraceEvent) {
+	if level < l.level {
+		return
+	}
+	b := l.encode(logEntry{time: time.Now(), level: level, msg: msg, event: event})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(b)
+}
+
+func encodeText(entry logEntry) []byte {
+	msg := entry.msg
+	if entry.event != nil {
+		msg = entry.event.String()
+	}
+	// keep one log per line
+	msg = strings.ReplaceAll(msg, "\n", " ")
+	return []byte(fmt.Sprintf("%s %s %s\n", entry.time.Format(time.RFC3339Nano), levelNames[entry.level], msg))
+}
+
+type jsonEntry struct {
+	Time       string        `json:"time"`
+	Level      string        `json:"level"`
+	Msg        string        `json:"msg"`
+	SQL        string        `json:"sql,omitempty"`
+	Vars       []interface{} `json:"vars,omitempty"`
+	DurationMS *float64      `json:"duration_ms,omitempty"`
+	Rows       *int64        `json:"rows,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func encodeJSON(entry logEntry) []byte {
+	e := jsonEntry{Time: entry.time.Format(time.RFC3339Nano), Level: levelNames[entry.level], Msg: entry.msg}
+	if event := entry.event; event != nil {
+		duration := float64(event.Duration) / float64(time.Millisecond)
+		rows := event.Rows
+		e.SQL, e.Vars, e.DurationMS, e.Rows = event.SQL, event.Vars, &duration, &rows
+		if event.Err != nil {
+			e.Error = event.Err.Error()
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		// the vars can not be encoded, like a channel, log them as text
+		e.Vars = []interface{}{fmt.Sprint(e.Vars...)}
+		if b, err = json.Marshal(e); err != nil {
+			b, _ = json.Marshal(jsonEntry{Time: e.Time, Level: e.Level, Msg: e.Msg, Error: err.Error()})
+		}
+	}
+	return append(b, '\n')
+}
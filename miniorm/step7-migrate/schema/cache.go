@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"reflect"
+	"sync"
+
+	"miniorm/dialect"
+)
+
+// Cache caches the parsed schemas by the struct type of model, the dialect and the naming strategy, it is safe
+// for concurrent use and usually shared by all sessions of an engine
+//  the dialect and naming strategy must be comparable because they are part of the key
+type Cache struct {
+	schemas sync.Map // cacheKey -> *Schema
+}
+
+type cacheKey struct {
+	modelType reflect.Type
+	dialect   dialect.Dialect
+	naming    NamingStrategy
+}
+
+// Parse returns the cached schema of model, the model is parsed at the first time
+//  the Model of cached schema is a pointer to the zero value of struct instead of dst, because the cached schema
+//  is shared and must not hold the instance of caller
+func (c *Cache) Parse(dst interface{}, dialect dialect.Dialect, naming NamingStrategy) (schema *Schema, err error) {
+	modelType, err := modelTypeOf(dst)
+	if err != nil {
+		return
+	}
+	key := cacheKey{modelType: modelType, dialect: dialect, naming: naming}
+	if cached, ok := c.schemas.Load(key); ok {
+		return cached.(*Schema), nil
+	}
+	// the parse errors are not cached, they are returned every time
+	if schema, err = ParseWithNaming(reflect.New(modelType).Interface(), dialect, naming); err != nil {
+		return
+	}
+	cached, _ := c.schemas.LoadOrStore(key, schema)
+	return cached.(*Schema), nil
+}
@@ -0,0 +1,46 @@
+package schema
+
+import (
+	"sync"
+	"testing"
+)
+
+type Broken struct {
+	Id   int
+	Chan chan int
+}
+
+func TestCache_Parse(t *testing.T) {
+	cache := &Cache{}
+	var wg sync.WaitGroup
+	schemas := make([]*Schema, 10)
+	for i := range schemas {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			schemas[i], _ = cache.Parse(&User{Name: "Tom"}, testDial, DefaultNamingStrategy{})
+		}(i)
+	}
+	wg.Wait()
+	for _, schema := range schemas {
+		if schema == nil || schema != schemas[0] {
+			t.Fatal("failed to share the cached schema of User")
+		}
+	}
+	if user, ok := schemas[0].Model.(*User); !ok || user.Name != "" {
+		t.Fatalf("the model of cached schema should be a zero value, but got %v", schemas[0].Model)
+	}
+	if schema, _ := cache.Parse(User{}, testDial, DefaultNamingStrategy{}); schema != schemas[0] {
+		t.Fatal("the struct value and pointer should share the cached schema")
+	}
+	if schema, _ := cache.Parse(&User{}, testDial, SnakeNamingStrategy{}); schema == schemas[0] || schema.Name != "user" {
+		t.Fatal("the schema should be cached per naming strategy")
+	}
+
+	if _, err := cache.Parse(&Broken{}, testDial, DefaultNamingStrategy{}); err == nil {
+		t.Fatal("expect the error of unsupported field type")
+	}
+	if _, err := cache.Parse(1, testDial, DefaultNamingStrategy{}); err == nil {
+		t.Fatal("expect the error of non-struct model")
+	}
+}
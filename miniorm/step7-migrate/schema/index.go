@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"miniorm/ormlog"
+)
+
+// defaultIndexPriority is the priority of column in index if it is not given, the smaller one comes first
+const defaultIndexPriority = 10
+
+// Index represents an index of table, the columns tagged with the same index name form a composite index
+type Index struct {
+	Name   string
+	Unique bool
+	Fields []*Field // the columns of index, ordered by priority
+	Where  string   // the condition of partial index like "Age > 18", empty means a full index
+}
+
+// FieldNames returns the column names of index
+func (idx *Index) FieldNames() (names []string) {
+	for _, field := range idx.Fields {
+		names = append(names, field.Name)
+	}
+	return
+}
+
+type indexField struct {
+	field    *Field
+	priority int
+}
+
+// indexBuilder collects the index settings of fields, and builds the indexes of table in order of definition
+type indexBuilder struct {
+	table   string
+	indexes []*Index
+	fields  map[string][]indexField // index name -> columns with priority
+}
+
+func newIndexBuilder(table string) *indexBuilder {
+	return &indexBuilder{table: table, fields: make(map[string][]indexField)}
+}
+
+// add parses the index option of field like "idx_name,priority:2,where:Age > 18"
+//  the name is "idx_<table>_<column>" if it is not given, and "where" must be the last one in option because
+//  the condition may contain ','
+func (b *indexBuilder) add(field *Field, option string, unique bool) (err error) {
+	idx := &Index{Unique: unique}
+	priority := defaultIndexPriority
+	if i := strings.Index(strings.ToLower(option), "where:"); i >= 0 {
+		idx.Where = strings.TrimSpace(option[i+len("where:"):])
+		option = option[:i]
+	}
+	for i, part := range strings.Split(option, ",") {
+		part = strings.TrimSpace(part)
+		kv := strings.SplitN(part, ":", 2)
+		switch {
+		case len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "priority"):
+			p, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+			if err != nil {
+				return ormlog.New(fmt.Sprintf("invalid index priority %s of field %s", kv[1], field.Name))
+			}
+			priority = p
+		case i == 0 && len(kv) == 1:
+			idx.Name = part
+		}
+	}
+	if idx.Name == "" {
+		idx.Name = fmt.Sprintf("idx_%s_%s", b.table, field.Name)
+	}
+
+	if _, ok := b.fields[idx.Name]; !ok {
+		b.indexes = append(b.indexes, idx)
+	} else {
+		// merge the settings of composite index
+		for _, exist := range b.indexes {
+			if exist.Name == idx.Name {
+				exist.Unique = exist.Unique || idx.Unique
+				if exist.Where == "" {
+					exist.Where = idx.Where
+				}
+			}
+		}
+	}
+	b.fields[idx.Name] = append(b.fields[idx.Name], indexField{field: field, priority: priority})
+	return
+}
+
+func (b *indexBuilder) build() (indexes []*Index) {
+	for _, idx := range b.indexes {
+		fields := b.fields[idx.Name]
+		sort.SliceStable(fields, func(i, j int) bool {
+			return fields[i].priority < fields[j].priority
+		})
+		for _, f := range fields {
+			idx.Fields = append(idx.Fields, f.field)
+		}
+	}
+	return b.indexes
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Order struct {
+	Id     int    `miniorm:"PRIMARY KEY"`
+	UserId int    `miniorm:"index:idx_user_status,priority:2"`
+	Status string `miniorm:"index:idx_user_status,priority:1;index"`
+	Code   string `miniorm:"NOT NULL;uniqueIndex"`
+	Amount int    `miniorm:"index:idx_big_amount,where:Amount > 100 AND Status IN ('paid','done')"`
+}
+
+func TestParse_Indexes(t *testing.T) {
+	schema, err := Parse(&Order{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Order", err)
+	}
+	expected := []struct {
+		name   string
+		unique bool
+		fields []string
+		where  string
+	}{
+		{"idx_user_status", false, []string{"Status", "UserId"}, ""},
+		{"idx_Order_Status", false, []string{"Status"}, ""},
+		{"idx_Order_Code", true, []string{"Code"}, ""},
+		{"idx_big_amount", false, []string{"Amount"}, "Amount > 100 AND Status IN ('paid','done')"},
+	}
+	if len(schema.Indexes) != len(expected) {
+		t.Fatalf("expected %d indexes, actual: %d", len(expected), len(schema.Indexes))
+	}
+	for i, e := range expected {
+		idx := schema.Indexes[i]
+		if idx.Name != e.name || idx.Unique != e.unique || !reflect.DeepEqual(idx.FieldNames(), e.fields) || idx.Where != e.where {
+			t.Fatalf("failed to parse index %s, actual: %+v, fields: %v", e.name, idx, idx.FieldNames())
+		}
+	}
+	if schema.GetField("Code").Constraints != "NOT NULL" {
+		t.Fatal("failed to parse constraints of field with index")
+	}
+}
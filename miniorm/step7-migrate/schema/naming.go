@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy maps the struct and field names to the table and column names, and maps them back when the
+// Go structs are generated from database
+type NamingStrategy interface {
+	TableName(structName string) string
+	ColumnName(fieldName string) string
+	StructName(tableName string) string
+	FieldName(columnName string) string
+}
+
+// Tabler can be implemented by model to give its table name, it takes precedence over the naming strategy
+type Tabler interface {
+	TableName() string
+}
+
+// DefaultNamingStrategy uses the struct and field names as the table and column names, like "HomeAddr" -> "HomeAddr"
+//  it maps the names back in CamelCase, like "home_addr" -> "HomeAddr"
+type DefaultNamingStrategy struct{}
+
+func (DefaultNamingStrategy) TableName(structName string) string {
+	return structName
+}
+
+func (DefaultNamingStrategy) ColumnName(fieldName string) string {
+	return fieldName
+}
+
+func (DefaultNamingStrategy) StructName(tableName string) string {
+	return CamelCase(tableName)
+}
+
+func (DefaultNamingStrategy) FieldName(columnName string) string {
+	return CamelCase(columnName)
+}
+
+// SnakeNamingStrategy uses the names in snake_case, like "HomeAddr" -> "home_addr"
+//  it maps the names back in CamelCase, like "home_addr" -> "HomeAddr"
+type SnakeNamingStrategy struct{}
+
+func (SnakeNamingStrategy) TableName(structName string) string {
+	return SnakeCase(structName)
+}
+
+func (SnakeNamingStrategy) ColumnName(fieldName string) string {
+	return SnakeCase(fieldName)
+}
+
+func (SnakeNamingStrategy) StructName(tableName string) string {
+	return CamelCase(tableName)
+}
+
+func (SnakeNamingStrategy) FieldName(columnName string) string {
+	return CamelCase(columnName)
+}
+
+// SnakeCase converts the name to snake_case, like "HomeAddr" -> "home_addr" and "UserID" -> "user_id"
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				builder.WriteRune('_')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
+
+// CamelCase converts the name to an exported Go identifier, like "home_addr" -> "HomeAddr" and "2fa" -> "X2fa"
+func CamelCase(name string) string {
+	var builder strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		builder.WriteString(string(runes))
+	}
+	camel := builder.String()
+	if camel == "" || !unicode.IsLetter([]rune(camel)[0]) {
+		camel = "X" + camel
+	}
+	return camel
+}
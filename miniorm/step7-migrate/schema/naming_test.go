@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"HomeAddr": "home_addr",
+		"UserID":   "user_id",
+		"HTTPCode": "http_code",
+		"Addr2":    "addr2",
+		"Id":       "id",
+	} {
+		if got := SnakeCase(name); got != expected {
+			t.Fatalf("expect SnakeCase(%s) = %s, but got %s", name, expected, got)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"home_addr": "HomeAddr",
+		"user id":   "UserId",
+		"Name":      "Name",
+		"2fa":       "X2fa",
+	} {
+		if got := CamelCase(name); got != expected {
+			t.Fatalf("expect CamelCase(%s) = %s, but got %s", name, expected, got)
+		}
+	}
+}
+
+type HomeAddr struct {
+	AddrId   int    `miniorm:"PRIMARY KEY"`
+	ZipCode  string `miniorm:"column:zip;index"`
+	OwnerId  int
+	Owner    *Owner `miniorm:"foreignKey:OwnerId"`
+	Building string
+}
+
+type Owner struct {
+	Code string `miniorm:"PRIMARY KEY;column:owner_code"`
+}
+
+func (Owner) TableName() string {
+	return "owners"
+}
+
+func TestParseWithNaming(t *testing.T) {
+	schema, err := ParseWithNaming(&HomeAddr{}, testDial, SnakeNamingStrategy{})
+	if err != nil {
+		t.Fatal("failed to parse HomeAddr", err)
+	}
+	if schema.Name != "home_addr" || len(schema.Fields) != 4 {
+		t.Fatalf("failed to parse HomeAddr in snake case, name: %s, fields: %v", schema.Name, schema.FieldNames)
+	}
+	if schema.PrimaryField.Name != "addr_id" || schema.GetField("zip") == nil || schema.GetField("owner_id") == nil {
+		t.Fatalf("failed to map the column names of HomeAddr, fields: %v", schema.FieldNames)
+	}
+	if schema.Indexes[0].Name != "idx_home_addr_zip" {
+		t.Fatalf("failed to name index by column name, index: %s", schema.Indexes[0].Name)
+	}
+	expected := "FOREIGN KEY (owner_id) REFERENCES owners (owner_code)"
+	if schema.ForeignKeys[0].SQL() != expected {
+		t.Fatalf("expect foreign key %s, but got %s", expected, schema.ForeignKeys[0].SQL())
+	}
+
+	values, err := schema.Struct2Value(&HomeAddr{AddrId: 1, ZipCode: "100", Building: "A"})
+	if err != nil || len(values) != 4 || values[1] != "100" || values[3] != "A" {
+		t.Fatalf("failed to get values by field index, values: %v, err: %v", values, err)
+	}
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"miniorm/ormlog"
+)
+
+// ForeignKey represents a FOREIGN KEY constraint of table, it is defined on the relationship field like
+//  User User `miniorm:"foreignKey:UserId;references:Id;onDelete:CASCADE"`
+//
+// the foreign key columns(UserId) belong to this table, and reference the columns(Id) of the table of field type
+type ForeignKey struct {
+	Fields    []string // the columns of this table
+	RefTable  string   // the referenced table
+	RefFields []string // the referenced columns, it is the primary key of referenced table if not given
+	OnDelete  string   // the action like "CASCADE", "SET NULL"
+	OnUpdate  string
+}
+
+// parseRelation parses the relationship field with tag 'miniorm:"foreignKey:..."', the field is not a column
+//  only the belongs-to relationship(field type is a struct or pointer of struct) makes the constraint of this
+//  table, the has-many relationship(slice of struct) should define the foreign key on the other side
+func parseRelation(member reflect.StructField, settings map[string][]string, naming NamingStrategy) (fk *ForeignKey, err error) {
+	typ := member.Type
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		if typ.Kind() != reflect.Ptr {
+			return nil, nil
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, ormlog.New(fmt.Sprintf("relationship field %s must be a struct, but got %s", member.Name, typ.Kind()))
+	}
+	fk = &ForeignKey{
+		Fields:   splitNames(settings["foreignkey"][0]),
+		RefTable: tableNameOf(typ, naming),
+	}
+	if refs, ok := settings["references"]; ok {
+		for _, name := range splitNames(refs[0]) {
+			fk.RefFields = append(fk.RefFields, columnNameOf(typ, name, naming))
+		}
+	} else {
+		fk.RefFields = []string{primaryKeyOf(typ, naming)}
+	}
+	if actions, ok := settings["ondelete"]; ok {
+		fk.OnDelete = strings.ToUpper(actions[0])
+	}
+	if actions, ok := settings["onupdate"]; ok {
+		fk.OnUpdate = strings.ToUpper(actions[0])
+	}
+	if len(fk.Fields) == 0 || len(fk.Fields) != len(fk.RefFields) {
+		return nil, ormlog.New(fmt.Sprintf("foreign key %v of field %s does not match references %v",
+			fk.Fields, member.Name, fk.RefFields))
+	}
+	return
+}
+
+// primaryKeyOf returns the primary key column of the struct type by its tags, it does not parse the whole schema
+// of the type to avoid the endless recursion of the relationships, "Id" is returned if no primary key is tagged
+func primaryKeyOf(typ reflect.Type, naming NamingStrategy) string {
+	for i := 0; i < typ.NumField(); i++ {
+		member := typ.Field(i)
+		if tag, ok := member.Tag.Lookup("miniorm"); ok {
+			constraints, _ := parseTag(tag)
+			if strings.Contains(strings.ToUpper(constraints), "PRIMARY KEY") {
+				return columnNameOf(typ, member.Name, naming)
+			}
+		}
+	}
+	return naming.ColumnName("Id")
+}
+
+// columnNameOf returns the column name of the field of struct type by its tag or the naming strategy
+func columnNameOf(typ reflect.Type, fieldName string, naming NamingStrategy) string {
+	if member, ok := typ.FieldByName(fieldName); ok {
+		if tag, ok := member.Tag.Lookup("miniorm"); ok {
+			if _, settings := parseTag(tag); len(settings["column"]) > 0 && settings["column"][0] != "" {
+				return settings["column"][0]
+			}
+		}
+	}
+	return naming.ColumnName(fieldName)
+}
+
+func splitNames(names string) (list []string) {
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, name)
+		}
+	}
+	return
+}
+
+// SQL returns the FOREIGN KEY clause like "FOREIGN KEY (UserId) REFERENCES User (Id) ON DELETE CASCADE"
+func (fk *ForeignKey) SQL() string {
+	return fk.QuotedSQL(func(identifier string) string { return identifier })
+}
+
+// QuotedSQL returns the FOREIGN KEY clause with the table and column names quoted by quote, like Dialect.Quote
+func (fk *ForeignKey) QuotedSQL(quote func(identifier string) string) string {
+	quoteAll := func(names []string) string {
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = quote(name)
+		}
+		return strings.Join(quoted, ", ")
+	}
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteAll(fk.Fields), quote(fk.RefTable), quoteAll(fk.RefFields)))
+	if fk.OnDelete != "" {
+		builder.WriteString(" ON DELETE " + fk.OnDelete)
+	}
+	if fk.OnUpdate != "" {
+		builder.WriteString(" ON UPDATE " + fk.OnUpdate)
+	}
+	return builder.String()
+}
@@ -0,0 +1,45 @@
+package schema
+
+import (
+	"testing"
+)
+
+type Author struct {
+	Name string `miniorm:"PRIMARY KEY"`
+}
+
+type Book struct {
+	Id         int `miniorm:"PRIMARY KEY"`
+	AuthorName string
+	Author     *Author  `miniorm:"foreignKey:AuthorName;onDelete:cascade"`
+	Reviews    []Review `miniorm:"foreignKey:BookId"`
+}
+
+type Review struct {
+	Id     int `miniorm:"PRIMARY KEY"`
+	BookId int
+	Book   Book `miniorm:"foreignKey:BookId;references:Id;onUpdate:SET NULL"`
+}
+
+func TestParse_ForeignKeys(t *testing.T) {
+	book, err := Parse(&Book{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Book", err)
+	}
+	if len(book.Fields) != 2 || len(book.ForeignKeys) != 1 {
+		t.Fatalf("failed to skip relationship fields, fields: %v, foreign keys: %d", book.FieldNames, len(book.ForeignKeys))
+	}
+	expected := "FOREIGN KEY (AuthorName) REFERENCES Author (Name) ON DELETE CASCADE"
+	if book.ForeignKeys[0].SQL() != expected {
+		t.Fatalf("failed to parse foreign key of Book, expected: %s, actual: %s", expected, book.ForeignKeys[0].SQL())
+	}
+
+	review, err := Parse(&Review{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Review", err)
+	}
+	expected = "FOREIGN KEY (BookId) REFERENCES Book (Id) ON UPDATE SET NULL"
+	if len(review.ForeignKeys) != 1 || review.ForeignKeys[0].SQL() != expected {
+		t.Fatalf("failed to parse foreign key of Review, expected: %s", expected)
+	}
+}
@@ -1,66 +1,260 @@
 package schema
 
 import (
+	"fmt"
 	"go/ast"
 	"reflect"
+	"regexp"
+	"strings"
 
 	"miniorm/dialect"
+	"miniorm/ormlog"
 )
 
 // Field represents a column of database
 type Field struct {
-	Name        string
+	Name        string // column name, it is mapped from the struct field name by naming strategy or tag 'miniorm:"column:name"'
+	Index       []int  // the index path of struct field, used by reflect.Value.FieldByIndex
 	Type        string
-	Constraints string // the constraints are parsed from struct field tag 'miniorm'
+	Constraints string     // the constraints are parsed from struct field tag 'miniorm'
+	PrimaryKey  bool       // the column is (part of) the primary key, parsed from the constraints
+	Version     bool       // the column is used for optimistic locking, tagged by 'miniorm:"version"'
+	Serializer  Serializer // encodes the field value to column value, tagged by 'miniorm:"serializer:json"'
+}
+
+// defaultRegexp matches the default value in constraints like "DEFAULT 0" or "DEFAULT 'Tom'"
+var defaultRegexp = regexp.MustCompile(`(?i)\bDEFAULT\s+('(?:[^']|'')*'|\([^)]*\)|[^\s,]+)`)
+
+// Nullable reports whether the column can be NULL, the column is nullable if there is no NOT NULL in constraints
+func (f *Field) Nullable() bool {
+	return !strings.Contains(strings.ToUpper(f.Constraints), "NOT NULL")
+}
+
+// Unique reports whether the column has UNIQUE constraint
+func (f *Field) Unique() bool {
+	return strings.Contains(strings.ToUpper(f.Constraints), "UNIQUE")
+}
+
+// Default returns the default value expression in constraints like "0" for "NOT NULL DEFAULT 0"
+func (f *Field) Default() (value string, ok bool) {
+	matches := defaultRegexp.FindStringSubmatch(f.Constraints)
+	if matches == nil {
+		return
+	}
+	return matches[1], true
 }
 
 // Schema represents a table of database
 type Schema struct {
-	Model      interface{}       // the mapping object(pointer instance of Table struct)
-	Name       string            // table name
-	Fields     []*Field          // columns in table
-	FieldNames []string          // column names in table
-	fieldMap   map[string]*Field // the mapping of column name and column object, used for get column object by name
+	Model        interface{}       // the mapping object(pointer instance of Table struct)
+	Name         string            // table name
+	Fields       []*Field          // columns in table
+	FieldNames   []string          // column names in table
+	PrimaryField *Field            // the first primary key column, nil if the table has no primary key
+	VersionField *Field            // the optimistic locking column, nil if the table has no version column
+	Indexes      []*Index          // the indexes defined by tag 'miniorm:"index"' and 'miniorm:"uniqueIndex"'
+	ForeignKeys  []*ForeignKey     // the foreign keys defined by tag 'miniorm:"foreignKey:UserId"' of relationship field
+	fieldMap     map[string]*Field // the mapping of column name and column object, used for get column object by name
 }
 
 func (s *Schema) GetField(name string) (field *Field) {
 	return s.fieldMap[name]
 }
 
-// Parse parses the given model to the specified schema of dialect
-func Parse(dst interface{}, dialect dialect.Dialect) (schema *Schema) {
-	modelType := reflect.Indirect(reflect.ValueOf(dst)).Type()
+// Parse parses the given model to the specified schema of dialect with the DefaultNamingStrategy
+func Parse(dst interface{}, dialect dialect.Dialect) (schema *Schema, err error) {
+	return ParseWithNaming(dst, dialect, DefaultNamingStrategy{})
+}
+
+// ParseWithNaming parses the given model to the specified schema of dialect, the table and column names are
+// mapped by naming strategy, unless they are given by the TableName method and tag 'miniorm:"column:name"'
+func ParseWithNaming(dst interface{}, dialect dialect.Dialect, naming NamingStrategy) (schema *Schema, err error) {
+	modelType, err := modelTypeOf(dst)
+	if err != nil {
+		return
+	}
 	schema = &Schema{
 		Model:    dst,
-		Name:     modelType.Name(),
+		Name:     tableNameOf(modelType, naming),
 		fieldMap: make(map[string]*Field),
 	}
+	indexes := newIndexBuilder(schema.Name)
+	structFields := make(map[string]*Field) // struct field name -> column
 	for i := 0; i < modelType.NumField(); i++ {
 		member := modelType.Field(i)
 		// skip the struct member which is anonymous and unexported
 		if !member.Anonymous && !ast.IsExported(member.Name) {
 			continue
 		}
-		field := &Field{
-			Name: member.Name,
+		field := &Field{Name: naming.ColumnName(member.Name), Index: member.Index}
+		if tag, ok := member.Tag.Lookup("miniorm"); ok {
+			constraints, settings := parseTag(tag)
+			// the relationship field is not a column
+			if _, ok := settings["foreignkey"]; ok {
+				fk, err := parseRelation(member, settings, naming)
+				if err != nil {
+					return nil, err
+				}
+				if fk != nil {
+					schema.ForeignKeys = append(schema.ForeignKeys, fk)
+				}
+				continue
+			}
+			if names, ok := settings["column"]; ok && names[0] != "" {
+				field.Name = names[0]
+			}
+			field.Constraints = constraints
+			_, field.Version = settings["version"]
+			if names, ok := settings["serializer"]; ok {
+				if field.Serializer, ok = GetSerializer(names[0]); !ok {
+					return nil, ormlog.New(fmt.Sprintf("serializer %s of field %s NOT FOUND", names[0], member.Name))
+				}
+			}
+			for _, option := range settings["index"] {
+				if err = indexes.add(field, option, false); err != nil {
+					return nil, err
+				}
+			}
+			for _, option := range settings["uniqueindex"] {
+				if err = indexes.add(field, option, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+		switch {
+		case field.Serializer == nil:
 			// TODO: figure it out why not use member.Type.String()
-			Type: dialect.DataTypeOf(reflect.Indirect(reflect.New(member.Type))),
+			field.Type, err = dataTypeOf(dialect, reflect.Indirect(reflect.New(member.Type)))
+		case field.Serializer.Binary():
+			field.Type, err = dataTypeOf(dialect, reflect.ValueOf([]byte{}))
+		default:
+			field.Type, err = dataTypeOf(dialect, reflect.ValueOf(""))
 		}
-		if tag, ok := member.Tag.Lookup("miniorm"); ok {
-			field.Constraints = tag
+		if err != nil {
+			return nil, ormlog.New(fmt.Sprintf("failed to parse field %s: %v", member.Name, err))
+		}
+		field.PrimaryKey = strings.Contains(strings.ToUpper(field.Constraints), "PRIMARY KEY")
+		if field.PrimaryKey && schema.PrimaryField == nil {
+			schema.PrimaryField = field
+		}
+		if field.Version && schema.VersionField == nil {
+			schema.VersionField = field
 		}
 		schema.Fields = append(schema.Fields, field)
 		schema.FieldNames = append(schema.FieldNames, field.Name)
 		schema.fieldMap[field.Name] = field
+		structFields[member.Name] = field
+	}
+	schema.Indexes = indexes.build()
+	// the foreign keys are given by struct field names, convert them to the column names
+	for _, fk := range schema.ForeignKeys {
+		for i, name := range fk.Fields {
+			field, ok := structFields[name]
+			if !ok {
+				return nil, ormlog.New(fmt.Sprintf("foreign key field %s NOT FOUND in %s", name, modelType.Name()))
+			}
+			fk.Fields[i] = field.Name
+		}
+	}
+	return
+}
+
+// modelTypeOf returns the struct type of model, the model should be a struct or a pointer of struct
+func modelTypeOf(dst interface{}) (modelType reflect.Type, err error) {
+	if dst == nil {
+		return nil, ormlog.New("model is nil")
+	}
+	modelType = reflect.TypeOf(dst)
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct {
+		return nil, ormlog.New(fmt.Sprintf("model must be a struct, but got %s", reflect.TypeOf(dst)))
 	}
 	return
 }
 
+// dataTypeOf returns the column type of value by dialect, the dialect panics for the unsupported types
+func dataTypeOf(dial dialect.Dialect, typ reflect.Value) (dataType string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = ormlog.New(fmt.Sprint(p))
+		}
+	}()
+	return dial.DataTypeOf(typ), nil
+}
+
+// tableNameOf returns the table name of model type by its TableName method or the naming strategy
+func tableNameOf(modelType reflect.Type, naming NamingStrategy) string {
+	if tabler, ok := reflect.New(modelType).Interface().(Tabler); ok {
+		return tabler.TableName()
+	}
+	return naming.TableName(modelType.Name())
+}
+
+// tagSettings are the keys in tag 'miniorm' that are handled by miniorm itself instead of being column constraints
+var tagSettings = map[string]struct{}{
+	"column":      {},
+	"version":     {},
+	"serializer":  {},
+	"index":       {},
+	"uniqueindex": {},
+	"foreignkey":  {},
+	"references":  {},
+	"ondelete":    {},
+	"onupdate":    {},
+}
+
+// parseTag splits the tag 'miniorm' by ';', the known settings like "version" are returned in settings
+// with the lower case key, and the others are joined as the column constraints like "NOT NULL UNIQUE"
+//  a setting can be given several times like "index:idx_a;index:idx_b", so the values of it are a list
+func parseTag(tag string) (constraints string, settings map[string][]string) {
+	settings = make(map[string][]string)
+	var parts []string
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if _, ok := tagSettings[key]; ok {
+			value := ""
+			if len(kv) == 2 {
+				value = strings.TrimSpace(kv[1])
+			}
+			settings[key] = append(settings[key], value)
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " "), settings
+}
+
 // Struct2Value converts struct instance to the column values like '&User{Name: "Tom", Age: 15}' -> ("Tom", 15)
-func (s *Schema) Struct2Value(src interface{}) (fields []interface{}) {
+//  the fields with serializer are encoded to the column values
+func (s *Schema) Struct2Value(src interface{}) (fields []interface{}, err error) {
 	ins := reflect.Indirect(reflect.ValueOf(src))
 	for _, field := range s.Fields {
-		fields = append(fields, ins.FieldByName(field.Name).Interface())
+		value, err := field.Serialize(ins.FieldByIndex(field.Index).Interface())
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, value)
+	}
+	return
+}
+
+// ScanDest returns the scan destinations of the columns for the addressable struct value dst,
+// the fields with serializer are decoded after scanning
+func (s *Schema) ScanDest(dst reflect.Value) (dest []interface{}) {
+	for _, field := range s.Fields {
+		value := dst.FieldByIndex(field.Index)
+		if field.Serializer != nil {
+			dest = append(dest, &serializerScanner{field: field, dst: value})
+			continue
+		}
+		dest = append(dest, value.Addr().Interface())
 	}
 	return
 }
@@ -1,6 +1,8 @@
 package schema
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"testing"
 
 	"miniorm/dialect"
@@ -15,7 +17,10 @@ type User struct {
 var testDial, _ = dialect.GetDialect("sqlite3")
 
 func TestParse(t *testing.T) {
-	schema := Parse(&User{}, testDial)
+	schema, err := Parse(&User{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse User", err)
+	}
 	if schema.Name != "User" || len(schema.Fields) != 3 {
 		t.Fatalf("failed to parse User struct, schema name: %s, fields: %d", schema.Name, len(schema.Fields))
 	}
@@ -23,3 +28,67 @@ func TestParse(t *testing.T) {
 		t.Fatal("failed to parse tag of struct field Name")
 	}
 }
+
+type Account struct {
+	Id      int `miniorm:"PRIMARY KEY"`
+	Version int `miniorm:"version"`
+}
+
+func TestParse_Version(t *testing.T) {
+	schema, err := Parse(&Account{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Account", err)
+	}
+	if schema.PrimaryField == nil || schema.PrimaryField.Name != "Id" {
+		t.Fatal("failed to parse primary key of struct Account")
+	}
+	if schema.VersionField == nil || schema.VersionField.Name != "Version" || schema.VersionField.Constraints != "" {
+		t.Fatal("failed to parse version field of struct Account")
+	}
+}
+
+// Level is a custom column type implements driver.Valuer and sql.Scanner
+type Level int
+
+func (l Level) DataType() string                  { return "smallint" }
+func (l Level) Value() (driver.Value, error)      { return int64(l), nil }
+func (l *Level) Scan(src interface{}) (err error) { *l = Level(src.(int64)); return }
+
+type Profile struct {
+	Nickname *string
+	Score    sql.NullInt64
+	Level    Level
+}
+
+func TestParse_Nullable(t *testing.T) {
+	schema, err := Parse(&Profile{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Profile", err)
+	}
+	expected := map[string]string{"Nickname": "text", "Score": "bigint", "Level": "smallint"}
+	for name, dataType := range expected {
+		if schema.GetField(name).Type != dataType {
+			t.Fatalf("failed to parse type of field %s, expected: %s, actual: %s",
+				name, dataType, schema.GetField(name).Type)
+		}
+	}
+}
+
+type Setting struct {
+	Options map[string]string `miniorm:"serializer:json"`
+	Tags    []string          `miniorm:"NOT NULL;serializer:gob"`
+}
+
+func TestParse_Serializer(t *testing.T) {
+	schema, err := Parse(&Setting{}, testDial)
+	if err != nil {
+		t.Fatal("failed to parse Setting", err)
+	}
+	options, tags := schema.GetField("Options"), schema.GetField("Tags")
+	if options.Type != "text" || options.Serializer == nil {
+		t.Fatalf("failed to parse json serializer field, type: %s", options.Type)
+	}
+	if tags.Type != "blob" || tags.Serializer == nil || tags.Constraints != "NOT NULL" {
+		t.Fatalf("failed to parse gob serializer field, type: %s, constraints: %s", tags.Type, tags.Constraints)
+	}
+}
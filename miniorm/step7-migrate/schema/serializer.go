@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"miniorm/ormlog"
+)
+
+// Serializer encodes the field value(map, slice, struct and so on) to the column value and decodes it back,
+// it is specified by tag like 'miniorm:"serializer:json"'
+type Serializer interface {
+	Serialize(value interface{}) (data []byte, err error)
+	Deserialize(data []byte, dst interface{}) (err error) // dst is the pointer of field value
+	Binary() bool                                         // the column is blob if true, otherwise it is text
+}
+
+var (
+	serializersMap = map[string]Serializer{
+		"json": JSONSerializer{},
+		"gob":  GobSerializer{},
+	}
+)
+
+func RegisterSerializer(name string, serializer Serializer) {
+	serializersMap[name] = serializer
+}
+
+func GetSerializer(name string) (serializer Serializer, ok bool) {
+	serializer, ok = serializersMap[name]
+	return
+}
+
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(value interface{}) (data []byte, err error) {
+	return json.Marshal(value)
+}
+
+func (JSONSerializer) Deserialize(data []byte, dst interface{}) (err error) {
+	return json.Unmarshal(data, dst)
+}
+
+func (JSONSerializer) Binary() bool {
+	return false
+}
+
+type GobSerializer struct{}
+
+func (GobSerializer) Serialize(value interface{}) (data []byte, err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(value); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Deserialize(data []byte, dst interface{}) (err error) {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst)
+}
+
+func (GobSerializer) Binary() bool {
+	return true
+}
+
+// Serialize converts the field value to the column value by the serializer of field,
+// the value is returned as it is if the field has no serializer
+//  the nil map, slice and pointer are stored as NULL
+func (f *Field) Serialize(value interface{}) (columnValue interface{}, err error) {
+	if f.Serializer == nil {
+		return value, nil
+	}
+	if v := reflect.ValueOf(value); !v.IsValid() || isNil(v) {
+		return nil, nil
+	}
+	data, err := f.Serializer.Serialize(value)
+	if err != nil {
+		return nil, ormlog.New(fmt.Sprintf("failed to serialize field %s: %v", f.Name, err))
+	}
+	if f.Serializer.Binary() {
+		return data, nil
+	}
+	return string(data), nil
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// serializerScanner implements sql.Scanner to decode the column value to the field by its serializer
+type serializerScanner struct {
+	field *Field
+	dst   reflect.Value // the addressable field value
+}
+
+func (s *serializerScanner) Scan(src interface{}) (err error) {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		s.dst.Set(reflect.Zero(s.dst.Type()))
+		return
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return ormlog.New(fmt.Sprintf("failed to deserialize field %s from %T", s.field.Name, src))
+	}
+	if err = s.field.Serializer.Deserialize(data, s.dst.Addr().Interface()); err != nil {
+		return ormlog.New(fmt.Sprintf("failed to deserialize field %s: %v", s.field.Name, err))
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"fmt"
+
+	"miniorm/cache"
+)
+
+// Cache returns a session which caches the results of Find, First and Count in c, the cached results of a table are
+// invalidated by Insert, Update, Delete, UpdateRecord and DeleteRecord of the table
+//  NOTES: the records are copied from cache shallowly, the pointer, slice and map fields are shared with the cache,
+//  and the writes by Raw do not invalidate the cache
+func (s *Session) Cache(c cache.Cache) (session *Session) {
+	session = s.clone()
+	session.cache = c
+	return
+}
+
+// NoCache returns a session which queries the database directly without the result cache
+func (s *Session) NoCache() (session *Session) {
+	session = s.clone()
+	session.noCache = true
+	return
+}
+
+// cacheable reports whether the query result can be read from and saved to the cache, the cache is bypassed in
+// transaction, because the uncommitted changes are invisible to others
+func (s *Session) cacheable() bool {
+	return s.cache != nil && !s.noCache && s.tx == nil
+}
+
+// cacheKey returns the key of the sql and vars in session
+func (s *Session) cacheKey() string {
+	return fmt.Sprintf("%s %#v", s.sql, s.sqlVars)
+}
+
+// invalidate removes the cached results of table, the table is invalidated again when the transaction commits,
+// because the results may be cached by others before the changes of transaction are visible
+func (s *Session) invalidate(table string) {
+	if s.cache == nil || table == "" {
+		return
+	}
+	s.cache.Invalidate(table)
+	if s.tx != nil {
+		s.txWrites[table] = struct{}{}
+	}
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"testing"
+
+	"miniorm/cache"
+)
+
+func TestSession_Cache(t *testing.T) {
+	c := cache.NewLRU(100, 0)
+	s := testRecord(t).Cache(c)
+
+	var users []User
+	if err := s.Where("Age > ?", 0).Find(&users); err != nil || len(users) != 2 {
+		t.Fatalf("failed to find users, users: %v, err: %v", users, err)
+	}
+	if count, err := s.Count(); err != nil || count != 2 || c.Len() != 2 {
+		t.Fatalf("failed to cache the results, count: %d, cached: %d, err: %v", count, c.Len(), err)
+	}
+	// change the table behind the cache
+	if _, err := s.Raw("DELETE FROM User WHERE Name = ?", "Tom").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	users = nil
+	if err := s.Where("Age > ?", 0).Find(&users); err != nil || len(users) != 2 || users[0].PrivateSecret == "" {
+		t.Fatalf("failed to find users from cache, users: %v, err: %v", users, err)
+	}
+	if count, _ := s.NoCache().Count(); count != 1 {
+		t.Fatalf("NoCache should query the database, count: %d", count)
+	}
+
+	// the writes invalidate the cache of table
+	if _, err := s.Insert(u2); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.Count(); count != 2 {
+		t.Fatalf("the cache should be invalidated by Insert, count: %d", count)
+	}
+
+	_, err := s.Transaction(func(s *Session) (result interface{}, err error) {
+		if _, err = s.Where("Name = ?", "Sam").Delete(); err != nil {
+			return
+		}
+		// the cache is bypassed in transaction
+		if count, _ := s.Count(); count != 1 {
+			t.Fatalf("the cache should be bypassed in transaction, count: %d", count)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.Count(); count != 1 {
+		t.Fatalf("the cache should be invalidated after commit, count: %d", count)
+	}
+}
@@ -0,0 +1,171 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"miniorm/ormlog"
+)
+
+// ErrDryRun is returned by QueryRows and the Scan of QueryRow in dry run, because there are no rows to read
+var ErrDryRun = ormlog.New("the statement is not executed in dry run")
+
+// Statement is the sql and vars built by session
+type Statement struct {
+	SQL  string
+	Vars []interface{}
+}
+
+// String returns the sql with vars interpolated for display, like SELECT * FROM User WHERE Name = 'Tom'
+//  NOTES: it is not escaped for the dialect, never run it
+func (st Statement) String() string {
+	var builder strings.Builder
+	var quote rune // the quote mark of the string literal or identifier being scanned
+	i := 0
+	for _, r := range strings.TrimSpace(st.SQL) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?' && i < len(st.Vars):
+			builder.WriteString(literalOf(st.Vars[i]))
+			i++
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// literalOf returns the SQL literal of var for display
+func literalOf(v interface{}) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		v = value
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return literalOf(rv.Elem().Interface())
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999999-07:00") + "'"
+	}
+	return fmt.Sprint(v)
+}
+
+// dryRun collects the statements built by the sessions chained from DryRun
+type dryRun struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+// DryRun returns a session whose statements are built and collected without executing, they are returned by
+// Statements of the session and the sessions chained from it, like:
+//  dry := s.Model(&User{}).DryRun()
+//  dry.Where("Age > ?", 18).Find(&users)
+//  dry.Statements() // SELECT "Id","Name","Age" FROM "User" WHERE Age > ?  [18]
+//  in dry run, Find finds nothing, First returns sql.ErrNoRows, Count counts 0 and the writes affect no rows, the
+//  After hooks are not called and the cache is neither read nor invalidated
+func (s *Session) DryRun() (session *Session) {
+	session = s.clone()
+	session.dryRun = &dryRun{}
+	return
+}
+
+// Statements returns the statements built in dry run, nil if the session is not in dry run
+func (s *Session) Statements() (statements []Statement) {
+	if s.dryRun == nil {
+		return
+	}
+	s.dryRun.mu.Lock()
+	defer s.dryRun.mu.Unlock()
+	return append(statements, s.dryRun.statements...)
+}
+
+// ToSQL runs f in dry run and returns the statements built by it with vars interpolated, they are separated by
+// ";\n" if more than one, like:
+//  s.ToSQL(func(s *Session) error {
+//  	return s.Model(&User{}).Where("Name = ?", "Tom").Find(&users)
+//  })
+//  // SELECT "Id","Name","Age" FROM "User" WHERE Name = 'Tom'
+func (s *Session) ToSQL(f func(s *Session) error) (sql string, err error) {
+	dry := s.DryRun()
+	if err = f(dry); err != nil {
+		return
+	}
+	var statements []string
+	for _, statement := range dry.Statements() {
+		statements = append(statements, statement.String())
+	}
+	return strings.Join(statements, ";\n"), nil
+}
+
+// dryRunned reports whether the session is in dry run, the statement in session is collected if it is
+func (s *Session) dryRunned() bool {
+	if s.dryRun == nil {
+		return false
+	}
+	s.dryRun.mu.Lock()
+	defer s.dryRun.mu.Unlock()
+	s.dryRun.statements = append(s.dryRun.statements, Statement{SQL: s.sql, Vars: s.sqlVars})
+	s.logger.Debugf("dry run: %s %v", s.sql, s.sqlVars)
+	return true
+}
+
+// dryRunResult is the result of Exec in dry run
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) {
+	return 0, ErrDryRun
+}
+
+func (dryRunResult) RowsAffected() (int64, error) {
+	return 0, nil
+}
+
+// dryRunDB is the database of QueryRow in dry run, the row returned by it fails with ErrDryRun without connecting
+// to any database, so it works with the session of nil db
+var dryRunDB = sql.OpenDB(dryRunConnector{})
+
+// dryRunConnector fails to connect with ErrDryRun
+type dryRunConnector struct{}
+
+func (dryRunConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrDryRun
+}
+
+func (dryRunConnector) Driver() driver.Driver {
+	return dryRunDriver{}
+}
+
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(string) (driver.Conn, error) {
+	return nil, ErrDryRun
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"miniorm/dialect"
+)
+
+func TestSession_DryRun(t *testing.T) {
+	s := testRecord(t)
+	dry := s.DryRun()
+	var users []User
+	if err := dry.Where("Age > ?", 10).Limit(0, 5).Find(&users); err != nil || len(users) != 0 {
+		t.Fatalf("Find should find nothing in dry run, users: %v, err: %v", users, err)
+	}
+	if _, err := dry.Insert(&User{Id: 4, Name: "Amy", Age: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dry.Where("Name = ?", "Tom").Update("Age", 30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dry.Where("Name = ?", "Tom").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := dry.Count(); err != nil || count != 0 {
+		t.Fatalf("Count should count 0 in dry run, count: %d, err: %v", count, err)
+	}
+	var n int
+	if err := dry.Raw("SELECT count(*) FROM User").QueryRow().Scan(&n); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("expect ErrDryRun, got %v", err)
+	}
+
+	statements := dry.Statements()
+	expect := []string{
+		`SELECT "Id","Name","Age","PrivateSecret" FROM "User" WHERE Age > 10 LIMIT 0, 5`,
+		`INSERT INTO "User" ("Id","Name","Age","PrivateSecret") VALUES (4, 'Amy', 7, '')`,
+		`UPDATE "User" SET "Age" = 30 WHERE Name = 'Tom'`,
+		`DELETE FROM "User" WHERE Name = 'Tom'`,
+		`SELECT count(*) FROM "User"`,
+		`SELECT count(*) FROM User`,
+	}
+	if len(statements) != len(expect) {
+		t.Fatalf("expect %d statements, got %v", len(expect), statements)
+	}
+	for i, statement := range statements {
+		if statement.String() != expect[i] {
+			t.Fatalf("expect statement %d %q, got %q", i, expect[i], statement.String())
+		}
+	}
+	if s.Statements() != nil {
+		t.Fatal("the original session should not be in dry run")
+	}
+	if count, _ := s.Count(); count != 2 {
+		t.Fatalf("the statements should not be executed in dry run, count: %d", count)
+	}
+}
+
+func TestSession_ToSQL(t *testing.T) {
+	s := NewSession("sqlite3").Model(&User{})
+	sql, err := s.ToSQL(func(s *Session) error {
+		_, err := s.Where("Name = ? AND Age IN (?, ?) AND PrivateSecret <> '?'", "O'Neil", 1, nil).Update("Age", true)
+		return err
+	})
+	expect := `UPDATE "User" SET "Age" = TRUE WHERE Name = 'O''Neil' AND Age IN (1, NULL) AND PrivateSecret <> '?'`
+	if err != nil || sql != expect {
+		t.Fatalf("expect %q, got %q, err: %v", expect, sql, err)
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sql, _ = s.ToSQL(func(s *Session) (err error) {
+		if _, err = s.Raw("SELECT ?, ?", at, []byte("ab")).Exec(); err != nil {
+			return
+		}
+		_, err = s.Raw("DELETE FROM User").Exec()
+		return
+	})
+	if expect = "SELECT '2024-01-02 03:04:05+00:00', X'6162';\nDELETE FROM User"; sql != expect {
+		t.Fatalf("expect %q, got %q", expect, sql)
+	}
+
+	// the statements are built without db
+	dial, _ := dialect.GetDialect("sqlite3")
+	var n int
+	if err = New(nil, dial).DryRun().Raw("SELECT 1").QueryRow().Scan(&n); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("expect ErrDryRun without db, got %v", err)
+	}
+}
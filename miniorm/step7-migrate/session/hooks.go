@@ -2,8 +2,6 @@ package session
 
 import (
 	"reflect"
-
-	"miniorm/ormlog"
 )
 
 const (
@@ -17,16 +15,17 @@ const (
 	AfterDelete  = "AfterDelete"
 )
 
+// CallHook calls the hook method of tableIns, or the hook method of the model in session if tableIns is nil
 func (s *Session) CallHook(method string, tableIns interface{}) {
-	table, err := s.RefTable()
-	if err != nil {
-		ormlog.Error(err)
-		return
-	}
-	hookFn := reflect.ValueOf(table.Model).MethodByName(method)
-	if tableIns != nil {
-		hookFn = reflect.ValueOf(tableIns).MethodByName(method)
+	if tableIns == nil {
+		table, err := s.RefTable()
+		if err != nil {
+			s.logger.Errorf("%v", err)
+			return
+		}
+		tableIns = table.Model
 	}
+	hookFn := reflect.ValueOf(tableIns).MethodByName(method)
 	if !hookFn.IsValid() {
 		return
 	}
@@ -35,7 +34,7 @@ func (s *Session) CallHook(method string, tableIns interface{}) {
 	returns := hookFn.Call(param)
 	if len(returns) > 0 {
 		if err, ok := returns[0].Interface().(error); ok {
-			ormlog.Error(err)
+			s.logger.Errorf("%v", err)
 			return
 		}
 	}
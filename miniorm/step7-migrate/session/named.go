@@ -0,0 +1,117 @@
+package session
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"miniorm/ormlog"
+)
+
+// bindNamed rewrites the named vars like @name in sql to the placeholders of dialect, and returns the values of
+// them in order, the same name can be used more than once
+//  the named values are given by sql.Named args, a map[string]interface{} or a struct(pointer) whose fields are
+//  matched by name, the sql and args are returned as they are if args are positional
+func (s *Session) bindNamed(sqlStr string, args []interface{}) (bound string, vars []interface{}, err error) {
+	if !strings.Contains(sqlStr, "@") {
+		return sqlStr, args, nil
+	}
+	lookup, ok, err := namedLookup(args)
+	if err != nil || !ok {
+		return sqlStr, args, err
+	}
+
+	var builder strings.Builder
+	runes := []rune(sqlStr)
+	var quote rune // the quote mark of the string literal or identifier being scanned
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '@' && i+1 < len(runes) && runes[i+1] == '@':
+			// the system variable of mysql like @@version
+			builder.WriteString("@@")
+			i++
+			continue
+		case r == '@' && i+1 < len(runes) && isNameStart(runes[i+1]) && (i == 0 || !isNamePart(runes[i-1])):
+			j := i + 1
+			for j < len(runes) && isNamePart(runes[j]) {
+				j++
+			}
+			name := string(runes[i+1 : j])
+			value, ok := lookup(name)
+			if !ok {
+				return "", nil, ormlog.New(fmt.Sprintf("named var @%s NOT FOUND in args", name))
+			}
+			vars = append(vars, value)
+			builder.WriteString(s.dialect.BindVar(len(vars)))
+			i = j - 1
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String(), vars, nil
+}
+
+// namedLookup returns the function to find the named value in args, ok is false if args are positional
+func namedLookup(args []interface{}) (lookup func(name string) (interface{}, bool), ok bool, err error) {
+	named := make(map[string]interface{})
+	for _, arg := range args {
+		if n, isNamed := arg.(sql.NamedArg); isNamed {
+			named[n.Name] = n.Value
+		}
+	}
+	if len(named) > 0 {
+		if len(named) != len(args) {
+			return nil, false, ormlog.New("can not mix the named args with positional args")
+		}
+		lookup = func(name string) (value interface{}, ok bool) {
+			value, ok = named[name]
+			return
+		}
+		return lookup, true, nil
+	}
+	if len(args) != 1 {
+		return nil, false, nil
+	}
+
+	switch arg := args[0].(type) {
+	case map[string]interface{}:
+		lookup = func(name string) (value interface{}, ok bool) {
+			value, ok = arg[name]
+			return
+		}
+		return lookup, true, nil
+	case driver.Valuer, time.Time:
+		return nil, false, nil
+	}
+	value := reflect.Indirect(reflect.ValueOf(args[0]))
+	if value.Kind() != reflect.Struct {
+		return nil, false, nil
+	}
+	lookup = func(name string) (interface{}, bool) {
+		field, ok := value.Type().FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return nil, false
+		}
+		return value.FieldByIndex(field.Index).Interface(), true
+	}
+	return lookup, true, nil
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNamePart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestSession_BindNamed(t *testing.T) {
+	s := NewSession("sqlite3")
+	tests := []struct {
+		sql      string
+		args     []interface{}
+		expected string
+		vars     []interface{}
+	}{
+		{
+			sql:      "SELECT * FROM User WHERE Age > @age OR (Age < @age AND Name = @name)",
+			args:     []interface{}{sql.Named("name", "Tom"), sql.Named("age", 18)},
+			expected: "SELECT * FROM User WHERE Age > ? OR (Age < ? AND Name = ?)",
+			vars:     []interface{}{18, 18, "Tom"},
+		},
+		{
+			sql:      "SELECT * FROM User WHERE Name = @name AND Email <> 'tom@example.com'",
+			args:     []interface{}{map[string]interface{}{"name": "Tom"}},
+			expected: "SELECT * FROM User WHERE Name = ? AND Email <> 'tom@example.com'",
+			vars:     []interface{}{"Tom"},
+		},
+		{
+			sql:      "SELECT * FROM User WHERE Name = @Name AND Age = @Age",
+			args:     []interface{}{&User{Name: "Tom", Age: 18}},
+			expected: "SELECT * FROM User WHERE Name = ? AND Age = ?",
+			vars:     []interface{}{"Tom", 18},
+		},
+		{
+			sql:      "SELECT * FROM User WHERE Name = ? AND Email = 'a@b'",
+			args:     []interface{}{"Tom"},
+			expected: "SELECT * FROM User WHERE Name = ? AND Email = 'a@b'",
+			vars:     []interface{}{"Tom"},
+		},
+	}
+	for _, test := range tests {
+		bound, vars, err := s.bindNamed(test.sql, test.args)
+		if err != nil || bound != test.expected || !reflect.DeepEqual(vars, test.vars) {
+			t.Fatalf("failed to bind %s\nexpected: %s %v\nactual: %s %v, err: %v",
+				test.sql, test.expected, test.vars, bound, vars, err)
+		}
+	}
+
+	if _, _, err := s.bindNamed("SELECT @missing", []interface{}{sql.Named("name", "Tom")}); err == nil {
+		t.Fatal("expect error for the missing named var")
+	}
+	if _, _, err := s.bindNamed("SELECT @name, ?", []interface{}{sql.Named("name", "Tom"), 1}); err == nil {
+		t.Fatal("expect error for the mixed named and positional args")
+	}
+}
+
+func TestSession_NamedVars(t *testing.T) {
+	s := testRecord(t)
+	var users []User
+	if err := s.Where("Age >= @min AND Age <= @max", sql.Named("min", 10), sql.Named("max", 11)).Find(&users); err != nil ||
+		len(users) != 1 || users[0].Name != "Tom" {
+		t.Fatalf("failed to find users by named vars, users: %v, err: %v", users, err)
+	}
+	row := s.Raw("SELECT count(*) FROM User WHERE Name = @Name OR Name = @Name", User{Name: "Jerry"}).QueryRow()
+	var count int
+	if err := row.Scan(&count); err != nil || count != 1 {
+		t.Fatalf("failed to count users by named vars, count: %d, err: %v", count, err)
+	}
+	if _, err := s.Where("Age = @age", map[string]interface{}{}).Count(); err == nil {
+		t.Fatal("expect error for the missing named var")
+	}
+}
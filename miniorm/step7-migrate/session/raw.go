@@ -3,9 +3,12 @@ package session
 import (
 	"database/sql"
 	"strings"
+	"time"
 
+	"miniorm/cache"
 	"miniorm/clause"
 	"miniorm/dialect"
+	"miniorm/instrument"
 	"miniorm/ormlog"
 	"miniorm/schema"
 )
@@ -24,24 +27,105 @@ type CommonDB interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
+// Session runs the statements on database, the chain methods like Model, Where and Raw return a new session with
+// the statement built so far and never change the original one, so that a base query can be reused and shared
+// between goroutines, like:
+//  active := s.Model(&User{}).Where("Active = ?", true)
+//  active.Limit(0, 10).Find(&page1)
+//  active.Count()
+//
+// NOTES: the transaction state set by Begin, Commit and Rollback is not a part of statement, it is kept in the
+// session and the sessions chained from it after Begin
 type Session struct {
-	db       *sql.DB         // database conn instance
-	tx       *sql.Tx         // for transaction, it means open transaction when it is not nil
-	dialect  dialect.Dialect // the database type of this session connected
-	refTable *schema.Schema  // the table of this session operates
-	clause   clause.Clause   // build the complete sql statement
-	sql      strings.Builder // use strings.Builder to avoid memory allocation when build sql
-	sqlVars  []interface{}   // the vars in sql placeholder
+	db              *sql.DB             // database conn instance
+	conn            *sql.Conn           // the dedicated connection to begin transaction on, nil means any connection of db
+	tx              *sql.Tx             // for transaction, it means open transaction when it is not nil
+	txDepth         int                 // the depth of nested transactions, the nested ones are implemented by savepoints
+	txWrites        map[string]struct{} // the tables written in transaction, their cached results are invalidated on commit
+	txEvent         *instrument.Event   // the instrumentation event of transaction, it is finished on commit or rollback
+	dialect         dialect.Dialect     // the database type of this session connected
+	refTable        *schema.Schema      // the table of this session operates
+	err             error               // the error of parsing model, it is returned by RefTable
+	stmtErr         error               // the error of building statement like binding named vars, returned when it runs
+	naming          schema.NamingStrategy
+	logger          ormlog.Logger
+	slowThreshold   time.Duration              // the statements take longer are logged at WARN, zero means no threshold
+	instrumentation instrument.Instrumentation // observes the statements and transactions, nil means no one
+	schemas         *schema.Cache              // the parsed schemas of models, it is shared by the sessions of engine
+	stmts           *StmtCache                 // the prepared statements shared by the sessions of engine, nil means no cache
+	cache           cache.Cache                // the cache of query results shared by the sessions of engine, nil means no cache
+	noCache         bool                       // query the database directly without cache
+	replicas        *Replicas                  // the read statements run on replicas, nil means no replica
+	primary         bool                       // run all the statements on the primary database
+	shardings       map[string]*Sharding       // the sharded tables of engine, nil means no table is sharded
+	routed          bool                       // the session has been routed to a shard of the sharded table
+	scatter         bool                       // Find runs on all shards if the shard key is not given
+	dryRun          *dryRun                    // collects the statements instead of executing, nil means not in dry run
+	clause          clause.Clause              // build the complete sql statement, it is copied on write
+	orders          []clause.OrderBy           // the columns of OrderBy, they are checked and built into clause when Find runs
+	sql             string                     // the raw sql to run
+	sqlVars         []interface{}              // the vars in sql placeholder
 }
 
 func New(db *sql.DB, dialect dialect.Dialect) *Session {
-	return &Session{db: db, dialect: dialect}
+	return &Session{db: db, dialect: dialect, naming: schema.DefaultNamingStrategy{}, schemas: &schema.Cache{},
+		logger: ormlog.Default, slowThreshold: DefaultSlowThreshold}
 }
 
-func (s *Session) Clear() {
-	s.sql.Reset()
-	s.sqlVars = nil
-	s.clause = clause.Clause{}
+// DefaultSlowThreshold is the slow threshold of the new session
+const DefaultSlowThreshold = 200 * time.Millisecond
+
+// Logger returns a session which writes the logs and the trace events of statements to logger
+func (s *Session) Logger(logger ormlog.Logger) (session *Session) {
+	session = s.clone()
+	session.logger = logger
+	return
+}
+
+// SlowThreshold returns a session whose statements taking longer than threshold are logged at WARN, zero means
+// no statement is slow
+func (s *Session) SlowThreshold(threshold time.Duration) (session *Session) {
+	session = s.clone()
+	session.slowThreshold = threshold
+	return
+}
+
+// SchemaCache returns a session which parses models by the naming strategy and shares the parsed schemas in cache
+func (s *Session) SchemaCache(schemas *schema.Cache, naming schema.NamingStrategy) (session *Session) {
+	session = s.clone()
+	session.schemas, session.naming = schemas, naming
+	return
+}
+
+// Quote quotes the table or column name by dialect, like "User" for sqlite3, it is used to build the raw sql
+func (s *Session) Quote(identifier string) string {
+	return s.dialect.Quote(identifier)
+}
+
+func (s *Session) quoteAll(identifiers []string) (quoted []string) {
+	quoted = make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = s.Quote(identifier)
+	}
+	return
+}
+
+// Clear returns a session without the statement built, the model is kept
+func (s *Session) Clear() (session *Session) {
+	session = s.clone()
+	session.sql = ""
+	session.sqlVars = nil
+	session.stmtErr = nil
+	session.clause = clause.Clause{}
+	return
+}
+
+// clone returns a copy of session to build a new statement on, the vars are copied and the clause is copied on
+// write, so the changes of copy never affect the original session
+func (s *Session) clone() *Session {
+	session := *s
+	session.sqlVars = append([]interface{}(nil), s.sqlVars...)
+	return &session
 }
 
 // DB returns *sql.Tx if a tx begins, otherwise returns *sql.DB
@@ -53,38 +137,175 @@ func (s *Session) DB() CommonDB {
 }
 
 func (s *Session) Exec() (res sql.Result, err error) {
-	defer s.Clear()
-	ormlog.Debug(s.sql.String(), s.sqlVars)
-	if res, err = s.DB().Exec(s.sql.String(), s.sqlVars...); err != nil {
-		ormlog.Error(err)
+	if s.stmtErr != nil {
+		s.logger.Errorf("%v", s.stmtErr)
+		return nil, s.stmtErr
+	}
+	if s.dryRunned() {
+		return dryRunResult{}, nil
+	}
+	event := s.startStatement()
+	if stmt, release := s.prepared(); stmt != nil {
+		defer release()
+		res, err = stmt.Exec(s.sqlVars...)
+	} else {
+		res, err = s.DB().Exec(s.sql, s.sqlVars...)
 	}
+	rows := int64(-1)
+	if err == nil {
+		// the rows affected is unknown if the driver does not support it
+		if n, rowsErr := res.RowsAffected(); rowsErr == nil {
+			rows = n
+		}
+	}
+	s.trace(event, rows, err)
 
 	return
 }
 
-// QueryRow get a record from table in session
+// QueryRow get a record from table in session, it runs on a replica like QueryRows
+//  NOTES: sql.Row can not carry the error of building statement, it is logged and the statement runs as it is,
+//  so that Scan returns the error of database
 func (s *Session) QueryRow() (row *sql.Row) {
-	defer s.Clear()
-	ormlog.Debug(s.sql.String(), s.sqlVars)
-	return s.DB().QueryRow(s.sql.String(), s.sqlVars...)
+	if s.stmtErr != nil {
+		s.logger.Errorf("%v", s.stmtErr)
+	}
+	if s.dryRunned() {
+		return dryRunDB.QueryRow(s.sql, s.sqlVars...)
+	}
+	event := s.startStatement()
+	db, onPrimary := s.readDB()
+	var stmt *sql.Stmt
+	var release func()
+	if onPrimary {
+		stmt, release = s.prepared()
+	}
+	if stmt != nil {
+		defer release()
+		row = stmt.QueryRow(s.sqlVars...)
+	} else {
+		row = db.QueryRow(s.sql, s.sqlVars...)
+	}
+	s.trace(event, -1, row.Err())
+	return
 }
 
-// QueryRows get the rows of a query
+// QueryRows get the rows of a query, it runs on a replica if the session has replicas and is not in transaction
 //  NOTES: sql.Rows is usually used for method QueryRows, and QueryRow returns sql.Row
 func (s *Session) QueryRows() (rows *sql.Rows, err error) {
-	defer s.Clear()
-	ormlog.Debug(s.sql.String(), s.sqlVars)
-	if rows, err = s.DB().Query(s.sql.String(), s.sqlVars...); err != nil {
-		ormlog.Error(err)
+	if s.stmtErr != nil {
+		s.logger.Errorf("%v", s.stmtErr)
+		return nil, s.stmtErr
+	}
+	if s.dryRunned() {
+		return nil, ErrDryRun
 	}
+	event := s.startStatement()
+	db, onPrimary := s.readDB()
+	var stmt *sql.Stmt
+	var release func()
+	if onPrimary {
+		stmt, release = s.prepared()
+	}
+	if stmt != nil {
+		// the rows keep the statement open until they are closed, even if it is evicted from cache
+		defer release()
+		rows, err = stmt.Query(s.sqlVars...)
+	} else {
+		rows, err = db.Query(s.sql, s.sqlVars...)
+	}
+	s.trace(event, -1, err)
 
 	return
 }
 
-// Raw get a session by raw sql
+// startStatement starts the instrumentation of the statement in session, the event is finished by trace
+func (s *Session) startStatement() (event *instrument.Event) {
+	event = &instrument.Event{Operation: operationOf(s.sql), Table: s.RefTableName(), SQL: s.sql, Vars: s.sqlVars,
+		Start: time.Now()}
+	if s.instrumentation != nil {
+		s.instrumentation.Start(event)
+	}
+	return
+}
+
+// trace finishes the instrumentation of the statement and logs it, it is slow if the duration reaches the slow
+// threshold
+func (s *Session) trace(event *instrument.Event, rows int64, err error) {
+	event.Duration, event.Err = time.Since(event.Start), err
+	if s.instrumentation != nil {
+		s.instrumentation.Finish(event)
+	}
+	s.logger.Trace(ormlog.TraceEvent{
+		SQL:      s.sql,
+		Vars:     s.sqlVars,
+		Duration: event.Duration,
+		Rows:     rows,
+		Err:      err,
+		Slow:     s.slowThreshold > 0 && event.Duration >= s.slowThreshold,
+	})
+}
+
+// operationOf returns the first keyword of sql in lower case as the operation, like "select"
+func operationOf(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(fields[0], ";("))
+}
+
+// Instrumentation returns a session whose statements and transactions are observed by instrumentation
+func (s *Session) Instrumentation(instrumentation instrument.Instrumentation) (session *Session) {
+	session = s.clone()
+	session.instrumentation = instrumentation
+	return
+}
+
+// prepared returns the cached prepared statement of the sql in session, it is bound to the transaction if any
+//  the statements are prepared on the primary database, so they are not used for replicas
+//  nil is returned if the cache is disabled or the sql can not be prepared on db, like the statement on the
+//  table created in the uncommitted transaction, then the sql runs without preparing
+//  in transaction, only the cached statement is used, because preparing on db needs another connection while
+//  the transaction holds one, which blocks forever if the pool is exhausted
+func (s *Session) prepared() (stmt *sql.Stmt, release func()) {
+	if s.stmts == nil {
+		return
+	}
+	if s.tx != nil {
+		stmt, release, ok := s.stmts.cached(s.sql)
+		if !ok {
+			return nil, nil
+		}
+		return s.tx.Stmt(stmt), release
+	}
+	stmt, release, err := s.stmts.get(s.sql)
+	if err != nil {
+		s.logger.Debugf("failed to prepare statement: %v", err)
+		return nil, nil
+	}
+	return
+}
+
+// StmtCache returns a session which runs the statements by the prepared statements in cache
+func (s *Session) StmtCache(stmts *StmtCache) (session *Session) {
+	session = s.clone()
+	session.stmts = stmts
+	return
+}
+
+// Raw get a session by raw sql, the sql is appended to the raw sql of s in the new session
+//  the vars can be named like @name, and their values are given by sql.Named args, a map[string]interface{} or
+//  a struct, like:
+//  s.Raw("SELECT * FROM User WHERE Age > @age OR Name = @name", sql.Named("age", 18), sql.Named("name", "Tom"))
+//  s.Raw("SELECT * FROM User WHERE Age > @Age", &User{Age: 18})
 func (s *Session) Raw(sql string, values ...interface{}) (session *Session) {
-	s.sql.WriteString(sql)
-	s.sql.WriteString(" ")
-	s.sqlVars = append(s.sqlVars, values...)
-	return s
+	session = s.clone()
+	sql, values, err := s.bindNamed(sql, values)
+	if err != nil && session.stmtErr == nil {
+		session.stmtErr = err
+	}
+	session.sql += sql + " "
+	session.sqlVars = append(session.sqlVars, values...)
+	return
 }
@@ -2,31 +2,65 @@ package session
 
 import (
 	"database/sql"
+	"fmt"
 	"reflect"
+	"strings"
 
 	"miniorm/clause"
+	"miniorm/ormlog"
 	"miniorm/schema"
 )
 
+// ErrStaleObject is returned by UpdateRecord and DeleteRecord when the record with the expected version is not
+// found, it means the record has been modified or deleted by others since it was read
+var ErrStaleObject = ormlog.New("stale object: the record has been modified or deleted")
+
 // Insert will insert records given by the instance of table struct
 func (s *Session) Insert(values ...interface{}) (rowsAffected int64, err error) {
+	if len(values) == 0 {
+		return
+	}
 	var recordValues []interface{}
-	var refTable *schema.Schema
+	c := s.clause
+	shard := -1
 	for _, value := range values {
+		s = s.Model(value)
 		s.CallHook(BeforeInsert, value)
-		refTable, err = s.Model(value).RefTable()
+		refTable, err := s.RefTable()
 		if err != nil {
+			return 0, err
+		}
+		c.Set(clause.INSERT, s.Quote(refTable.Name), s.quoteAll(refTable.FieldNames))
+		fields, err := refTable.Struct2Value(value)
+		if err != nil {
+			return 0, err
+		}
+		recordValues = append(recordValues, fields)
+		if sharding := s.sharding(); sharding != nil {
+			n, err := s.shardOfRecord(sharding, value)
+			if err != nil {
+				return 0, err
+			}
+			if shard >= 0 && n != shard {
+				return 0, ormlog.New(fmt.Sprintf("the records inserted into table %s at once must be in the same shard",
+					refTable.Name))
+			}
+			shard = n
+		}
+	}
+	if shard >= 0 {
+		if s, err = s.onShard(s.sharding(), shard); err != nil {
 			return
 		}
-		s.clause.Set(clause.INSERT, refTable.Name, refTable.FieldNames)
-		recordValues = append(recordValues, refTable.Struct2Value(value))
+		c.Set(clause.INSERT, s.Quote(s.refTable.Name), s.quoteAll(s.refTable.FieldNames))
 	}
-	s.clause.Set(clause.VALUES, recordValues...)
-	sqlClause, vars := s.clause.Build(clause.INSERT, clause.VALUES)
+	c.Set(clause.VALUES, recordValues...)
+	sqlClause, vars := c.Build(clause.INSERT, clause.VALUES)
 	result, err := s.Raw(sqlClause, vars...).Exec()
-	if err != nil {
+	if err != nil || s.dryRun != nil {
 		return
 	}
+	s.invalidate(s.RefTableName())
 	s.CallHook(AfterInsert, nil)
 
 	return result.RowsAffected()
@@ -51,36 +85,80 @@ func (s *Session) First(value interface{}) (err error) {
 
 // Find will set the records queried from database to the instance of table struct
 func (s *Session) Find(values interface{}) (err error) {
-	s.CallHook(BeforeQuery, nil)
 	dstSlc := reflect.Indirect(reflect.ValueOf(values))
 	dstType := dstSlc.Type().Elem()
-	refTable, err := s.Model(reflect.New(dstType).Elem().Interface()).RefTable()
-	if err != nil {
+	s = s.Model(reflect.New(dstType).Elem().Interface())
+	s.CallHook(BeforeQuery, nil)
+	if _, err = s.RefTable(); err != nil {
 		return
 	}
+	if sharding := s.sharding(); sharding != nil {
+		if _, ok := s.whereKey(sharding.Column); !ok && s.scatter {
+			return s.scatterFind(sharding, dstSlc)
+		}
+		if s, err = s.routeByWhere(); err != nil {
+			return
+		}
+	}
+	return s.find(dstSlc)
+}
 
-	s.clause.Set(clause.SELECT, refTable.Name, refTable.FieldNames)
+// find runs the query of Find on the table in session and appends the records to dstSlc
+func (s *Session) find(dstSlc reflect.Value) (err error) {
+	dstType := dstSlc.Type().Elem()
+	refTable := s.refTable
+	c := s.clause
+	c.Set(clause.SELECT, s.Quote(refTable.Name), s.quoteAll(refTable.FieldNames))
+	if len(s.orders) > 0 {
+		desc, err := s.orderByDesc(refTable)
+		if err != nil {
+			return err
+		}
+		c.Set(clause.ORDERBY, desc)
+	}
 	// NOTES: in the SELECT clause, add WHERE, ORDERBY and LIMIT in order whether it exists or not
-	sqlClause, vars := s.clause.Build(clause.SELECT, clause.WHERE, clause.ORDERBY, clause.LIMIT)
-	rows, err := s.Raw(sqlClause, vars...).QueryRows()
+	sqlClause, vars := c.Build(clause.SELECT, clause.WHERE, clause.ORDERBY, clause.LIMIT)
+	query := s.Raw(sqlClause, vars...)
+	if query.dryRunned() {
+		return
+	}
+	// the cached records are the scanned ones before the AfterQuery hook, the hook is called for every query
+	var records reflect.Value
+	if s.cacheable() {
+		if cached, ok := s.cache.Get(refTable.Name, query.cacheKey()); ok {
+			records = reflect.ValueOf(cached)
+			for i := 0; i < records.Len(); i++ {
+				dst := reflect.New(dstType).Elem()
+				dst.Set(records.Index(i))
+				s.CallHook(AfterQuery, dst.Addr().Interface())
+				dstSlc.Set(reflect.Append(dstSlc, dst))
+			}
+			return
+		}
+		records = reflect.MakeSlice(reflect.SliceOf(dstType), 0, 0)
+	}
+	rows, err := query.QueryRows()
 	if err != nil {
 		return
 	}
 
 	for rows.Next() {
 		dst := reflect.New(dstType).Elem()
-		var fields []interface{}
-		for _, name := range refTable.FieldNames {
-			fields = append(fields, dst.FieldByName(name).Addr().Interface())
-		}
-		if err = rows.Scan(fields...); err != nil {
+		if err = rows.Scan(refTable.ScanDest(dst)...); err != nil {
+			rows.Close()
 			return
 		}
+		if records.IsValid() {
+			records = reflect.Append(records, dst)
+		}
 		s.CallHook(AfterQuery, dst.Addr().Interface())
 		dstSlc.Set(reflect.Append(dstSlc, dst))
 	}
 
-	return rows.Close()
+	if err = rows.Close(); err == nil && records.IsValid() {
+		s.cache.Set(refTable.Name, query.cacheKey(), records.Interface())
+	}
+	return
 }
 
 // Update
@@ -89,6 +167,9 @@ func (s *Session) Find(values interface{}) (err error) {
 //      2.key-value pairs, it will be converted to map[string]interface{}, example: Update("Name", "Tom", "Age", 11)
 func (s *Session) Update(kv ...interface{}) (rowsAffected int64, err error) {
 	s.CallHook(BeforeUpdate, nil)
+	if s, err = s.routeByWhere(); err != nil {
+		return
+	}
 	m, ok := kv[0].(map[string]interface{})
 	if !ok {
 		m = make(map[string]interface{})
@@ -96,13 +177,27 @@ func (s *Session) Update(kv ...interface{}) (rowsAffected int64, err error) {
 			m[kv[i].(string)] = kv[i+1]
 		}
 	}
-	s.clause.Set(clause.UPDATE, s.RefTableName(), m)
+	quoted := make(map[string]interface{}, len(m))
+	for name, value := range m {
+		// encode the new values of the fields with serializer
+		if s.refTable != nil {
+			if field := s.refTable.GetField(name); field != nil {
+				if value, err = field.Serialize(value); err != nil {
+					return
+				}
+			}
+		}
+		quoted[s.Quote(name)] = value
+	}
+	c := s.clause
+	c.Set(clause.UPDATE, s.Quote(s.RefTableName()), quoted)
 	// NOTES: In order to build the correct sequence, add clause.WHERE in the end whether it exists or not
-	sqlClause, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
+	sqlClause, vars := c.Build(clause.UPDATE, clause.WHERE)
 	result, err := s.Raw(sqlClause, vars...).Exec()
-	if err != nil {
+	if err != nil || s.dryRun != nil {
 		return
 	}
+	s.invalidate(s.RefTableName())
 	s.CallHook(AfterUpdate, nil)
 
 	return result.RowsAffected()
@@ -110,49 +205,246 @@ func (s *Session) Update(kv ...interface{}) (rowsAffected int64, err error) {
 
 func (s *Session) Delete() (rowsAffected int64, err error) {
 	s.CallHook(BeforeDelete, nil)
-	s.clause.Set(clause.DELETE, s.RefTableName())
+	if s, err = s.routeByWhere(); err != nil {
+		return
+	}
+	c := s.clause
+	c.Set(clause.DELETE, s.Quote(s.RefTableName()))
 	// NOTES: In order to build the correct sequence, add clause.WHERE in the end whether it exists or not
-	sqlClause, vars := s.clause.Build(clause.DELETE, clause.WHERE)
+	sqlClause, vars := c.Build(clause.DELETE, clause.WHERE)
 	result, err := s.Raw(sqlClause, vars...).Exec()
-	if err != nil {
+	if err != nil || s.dryRun != nil {
 		return
 	}
+	s.invalidate(s.RefTableName())
 	s.CallHook(AfterDelete, nil)
 	return result.RowsAffected()
 }
 
+// UpdateRecord updates all columns of the given record, the record is located by its primary key
+//  if the model has a version field(tagged by 'miniorm:"version"'), "AND Version = ?" is added to the condition,
+//  the version increases by 1 on success and ErrStaleObject is returned when no rows are affected
+func (s *Session) UpdateRecord(value interface{}) (rowsAffected int64, err error) {
+	s.CallHook(BeforeUpdate, value)
+	if _, err = s.Model(value).RefTable(); err != nil {
+		return
+	}
+	if s, err = s.Model(value).routeByRecord(value); err != nil {
+		return
+	}
+	table := s.refTable
+	desc, vars, err := s.recordCondition(table, value)
+	if err != nil {
+		return
+	}
+	values, err := table.Struct2Value(value)
+	if err != nil {
+		return
+	}
+	m := make(map[string]interface{})
+	for i, v := range values {
+		if !table.Fields[i].PrimaryKey {
+			m[s.Quote(table.Fields[i].Name)] = v
+		}
+	}
+	var version reflect.Value
+	var next interface{}
+	if table.VersionField != nil {
+		version = reflect.Indirect(reflect.ValueOf(value)).FieldByIndex(table.VersionField.Index)
+		if next, err = nextVersion(version); err != nil {
+			return
+		}
+		m[s.Quote(table.VersionField.Name)] = next
+	}
+	c := s.clause
+	c.Set(clause.UPDATE, s.Quote(table.Name), m)
+	c.Set(clause.WHERE, append([]interface{}{desc}, vars...)...)
+	sqlClause, sqlVars := c.Build(clause.UPDATE, clause.WHERE)
+	result, err := s.Raw(sqlClause, sqlVars...).Exec()
+	if err != nil || s.dryRun != nil {
+		return
+	}
+	s.invalidate(table.Name)
+	if rowsAffected, err = result.RowsAffected(); err != nil {
+		return
+	}
+	if table.VersionField != nil {
+		if rowsAffected == 0 {
+			return 0, ErrStaleObject
+		}
+		if version.CanSet() {
+			version.Set(reflect.ValueOf(next))
+		}
+	}
+	s.CallHook(AfterUpdate, value)
+
+	return
+}
+
+// DeleteRecord deletes the given record located by its primary key
+//  if the model has a version field, "AND Version = ?" is added to the condition and ErrStaleObject is returned
+//  when no rows are affected
+func (s *Session) DeleteRecord(value interface{}) (rowsAffected int64, err error) {
+	s.CallHook(BeforeDelete, value)
+	if _, err = s.Model(value).RefTable(); err != nil {
+		return
+	}
+	if s, err = s.Model(value).routeByRecord(value); err != nil {
+		return
+	}
+	table := s.refTable
+	desc, vars, err := s.recordCondition(table, value)
+	if err != nil {
+		return
+	}
+	c := s.clause
+	c.Set(clause.DELETE, s.Quote(table.Name))
+	c.Set(clause.WHERE, append([]interface{}{desc}, vars...)...)
+	sqlClause, sqlVars := c.Build(clause.DELETE, clause.WHERE)
+	result, err := s.Raw(sqlClause, sqlVars...).Exec()
+	if err != nil || s.dryRun != nil {
+		return
+	}
+	s.invalidate(table.Name)
+	if rowsAffected, err = result.RowsAffected(); err != nil {
+		return
+	}
+	if table.VersionField != nil && rowsAffected == 0 {
+		return 0, ErrStaleObject
+	}
+	s.CallHook(AfterDelete, value)
+
+	return
+}
+
+// recordCondition builds the condition to locate the given record like "Id = ? AND Version = ?"
+func (s *Session) recordCondition(table *schema.Schema, value interface{}) (desc string, vars []interface{}, err error) {
+	if table.PrimaryField == nil {
+		return "", nil, ormlog.New(fmt.Sprintf("table %s has no primary key", table.Name))
+	}
+	ins := reflect.Indirect(reflect.ValueOf(value))
+	desc = fmt.Sprintf("%s = ?", s.Quote(table.PrimaryField.Name))
+	vars = append(vars, ins.FieldByIndex(table.PrimaryField.Index).Interface())
+	if table.VersionField != nil {
+		desc += fmt.Sprintf(" AND %s = ?", s.Quote(table.VersionField.Name))
+		vars = append(vars, ins.FieldByIndex(table.VersionField.Index).Interface())
+	}
+	return
+}
+
+// nextVersion returns the version value plus 1, the version field must be an integer
+func nextVersion(version reflect.Value) (next interface{}, err error) {
+	n := reflect.New(version.Type()).Elem()
+	switch version.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n.SetInt(version.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n.SetUint(version.Uint() + 1)
+	default:
+		return nil, ormlog.New(fmt.Sprintf("unsupported version field type %s", version.Type()))
+	}
+	return n.Interface(), nil
+}
+
 func (s *Session) Count() (count int64, err error) {
-	s.clause.Set(clause.COUNT, s.RefTableName())
+	if s, err = s.routeByWhere(); err != nil {
+		return
+	}
+	c := s.clause
+	c.Set(clause.COUNT, s.Quote(s.RefTableName()))
 	// NOTES: In order to build the correct sequence, add clause.WHERE in the end whether it exists or not
-	sqlClause, vars := s.clause.Build(clause.COUNT, clause.WHERE)
-	row := s.Raw(sqlClause, vars...).QueryRow()
-	if err != nil {
+	sqlClause, vars := c.Build(clause.COUNT, clause.WHERE)
+	if s.stmtErr != nil {
+		return 0, s.stmtErr
+	}
+	query := s.Raw(sqlClause, vars...)
+	if query.dryRunned() {
 		return
 	}
-	if err = row.Scan(&count); err != nil {
+	if s.cacheable() {
+		if cached, ok := s.cache.Get(s.RefTableName(), query.cacheKey()); ok {
+			return cached.(int64), nil
+		}
+	}
+	if err = query.QueryRow().Scan(&count); err != nil {
 		return
 	}
+	if s.cacheable() {
+		s.cache.Set(s.RefTableName(), query.cacheKey(), count)
+	}
 
 	return
 }
 
 // Where
+//  the vars can be named like @name, see Raw
 //  if there are multiple WHERE clause in the chain, only the last one takes effect
 func (s *Session) Where(desc string, args ...interface{}) (session *Session) {
-	s.clause.Set(clause.WHERE, append(append([]interface{}{}, desc), args...)...)
-	return s
+	session = s.clone()
+	desc, args, err := s.bindNamed(desc, args)
+	if err != nil && session.stmtErr == nil {
+		session.stmtErr = err
+	}
+	session.clause.Set(clause.WHERE, append(append([]interface{}{}, desc), args...)...)
+	return
 }
 
 // Limit
 //  if there are multiple LIMIT clause in the chain, only the last one takes effect
 func (s *Session) Limit(offset, limit uint64) (session *Session) {
-	s.clause.Set(clause.LIMIT, offset, limit)
-	return s
+	session = s.clone()
+	session.clause.Set(clause.LIMIT, offset, limit)
+	return
 }
 
-// OrderBy
+// OrderBy sorts the query result by the columns of model, the columns are matched case-insensitively when the
+// statement runs, and Find returns an error if any of them is not a column of model, so the user input is safe
 //  if there are multiple ORDERBY clause in the chain, only the last one takes effect
-func (s *Session) OrderBy(desc string) (session *Session) {
-	s.clause.Set(clause.ORDERBY, desc)
-	return s
+func (s *Session) OrderBy(orders ...clause.OrderBy) (session *Session) {
+	session = s.clone()
+	session.orders = nil
+	// the order-desc of OrderByRaw is replaced too, no column means no order, like the Sort of an empty sort string
+	session.clause.Remove(clause.ORDERBY)
+	if len(orders) > 0 {
+		session.orders = append([]clause.OrderBy{}, orders...)
+	}
+	return
+}
+
+// Sort sorts the query result by the sort string like "-Age,Name", see clause.ParseOrderBy,
+// the columns are checked like OrderBy
+func (s *Session) Sort(sort string) (session *Session) {
+	return s.OrderBy(clause.ParseOrderBy(sort)...)
+}
+
+// OrderByRaw sorts the query result by the raw order-desc like "Age DESC, length(Name)", it is not checked,
+// so never pass the user input to it
+//  if there are multiple ORDERBY clause in the chain, only the last one takes effect
+func (s *Session) OrderByRaw(desc string) (session *Session) {
+	session = s.clone()
+	session.orders = nil
+	session.clause.Set(clause.ORDERBY, desc)
+	return
+}
+
+// orderByDesc builds the order-desc of OrderBy columns like "Age" DESC, "Name" ASC
+func (s *Session) orderByDesc(table *schema.Schema) (desc string, err error) {
+	var columns []string
+	for _, order := range s.orders {
+		field := table.GetField(order.Column)
+		for i := 0; field == nil && i < len(table.Fields); i++ {
+			if strings.EqualFold(table.Fields[i].Name, order.Column) {
+				field = table.Fields[i]
+			}
+		}
+		if field == nil {
+			return "", ormlog.New(fmt.Sprintf("can not order by %q, it is not a column of table %s", order.Column, table.Name))
+		}
+		direction := "ASC"
+		if order.Desc {
+			direction = "DESC"
+		}
+		columns = append(columns, s.Quote(field.Name)+" "+direction)
+	}
+	return strings.Join(columns, ", "), nil
 }
@@ -1,8 +1,15 @@
 package session
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"miniorm/clause"
 	"miniorm/ormlog"
 )
 
@@ -92,3 +99,214 @@ func TestSession_Find(t *testing.T) {
 	}
 	t.Log(users)
 }
+
+type Account struct {
+	Id      int `miniorm:"PRIMARY KEY"`
+	Balance int
+	Version int `miniorm:"version"`
+}
+
+func testAccount(t *testing.T) (s *Session) {
+	t.Helper()
+	s = NewSession("sqlite3").Model(&Account{})
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert(&Account{Id: 1, Balance: 100, Version: 1})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("failed to init test accounts:\ndrop-table-err: %v\ncreate-table-err: %v\ninsert-err: %v",
+			err1, err2, err3)
+	}
+	return
+}
+
+func TestSession_UpdateRecord(t *testing.T) {
+	s := testAccount(t)
+	a1, a2 := &Account{}, &Account{}
+	if err1, err2 := s.First(a1), s.First(a2); err1 != nil || err2 != nil {
+		t.Fatalf("failed to query accounts, err1: %v, err2: %v", err1, err2)
+	}
+
+	a1.Balance = 50
+	if _, err := s.UpdateRecord(a1); err != nil {
+		t.Fatalf("failed to update record, err: %v", err)
+	}
+	if a1.Version != 2 {
+		t.Fatalf("expected version 2 after update, actual version: %d", a1.Version)
+	}
+	a2.Balance = 200
+	if _, err := s.UpdateRecord(a2); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("expected ErrStaleObject for the stale record, actual err: %v", err)
+	}
+
+	var a Account
+	if err := s.First(&a); err != nil || a.Balance != 50 || a.Version != 2 {
+		t.Fatalf("failed to keep the first update, account: %v, err: %v", a, err)
+	}
+}
+
+func TestSession_DeleteRecord(t *testing.T) {
+	s := testAccount(t)
+	stale := &Account{Id: 1, Version: 0}
+	if _, err := s.DeleteRecord(stale); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("expected ErrStaleObject for the stale record, actual err: %v", err)
+	}
+	rowsAffected, err := s.DeleteRecord(&Account{Id: 1, Version: 1})
+	if err != nil || rowsAffected != 1 {
+		t.Fatalf("failed to delete record, rows affected: %d, err: %v", rowsAffected, err)
+	}
+}
+
+type Contact struct {
+	Id    int `miniorm:"PRIMARY KEY"`
+	Email *string
+	Phone sql.NullString
+}
+
+func TestSession_FindNull(t *testing.T) {
+	s := NewSession("sqlite3").Model(&Contact{})
+	email := "tom@example.com"
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert(&Contact{Id: 1}, &Contact{Id: 2, Email: &email, Phone: sql.NullString{String: "110", Valid: true}})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("failed to init test contacts:\ndrop-table-err: %v\ncreate-table-err: %v\ninsert-err: %v",
+			err1, err2, err3)
+	}
+
+	var contacts []Contact
+	if err := s.OrderBy(clause.OrderBy{Column: "Id"}).Find(&contacts); err != nil {
+		t.Fatalf("failed to find contacts, err: %v", err)
+	}
+	if len(contacts) != 2 || contacts[0].Email != nil || contacts[0].Phone.Valid {
+		t.Fatalf("failed to scan NULL into nullable fields, contacts: %v", contacts)
+	}
+	if contacts[1].Email == nil || *contacts[1].Email != email || contacts[1].Phone.String != "110" {
+		t.Fatalf("failed to scan values into nullable fields, contacts: %v", contacts)
+	}
+}
+
+type Preference struct {
+	Id      int               `miniorm:"PRIMARY KEY"`
+	Options map[string]string `miniorm:"serializer:json"`
+	Tags    []string          `miniorm:"serializer:gob"`
+}
+
+func TestSession_Serializer(t *testing.T) {
+	s := NewSession("sqlite3").Model(&Preference{})
+	p := &Preference{Id: 1, Options: map[string]string{"theme": "dark"}, Tags: []string{"a", "b"}}
+	err1 := s.DropTable()
+	err2 := s.CreateTable()
+	_, err3 := s.Insert(p, &Preference{Id: 2})
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("failed to init test preferences:\ndrop-table-err: %v\ncreate-table-err: %v\ninsert-err: %v",
+			err1, err2, err3)
+	}
+	if _, err := s.Where("Id = ?", 2).Update("Tags", []string{"c"}); err != nil {
+		t.Fatalf("failed to update serializer field, err: %v", err)
+	}
+
+	var prefs []Preference
+	if err := s.OrderByRaw("Id ASC").Find(&prefs); err != nil {
+		t.Fatalf("failed to find preferences, err: %v", err)
+	}
+	if len(prefs) != 2 || !reflect.DeepEqual(prefs[0], *p) {
+		t.Fatalf("failed to decode serializer fields, preferences: %v", prefs)
+	}
+	if prefs[1].Options != nil || !reflect.DeepEqual(prefs[1].Tags, []string{"c"}) {
+		t.Fatalf("failed to decode updated serializer fields, preference: %v", prefs[1])
+	}
+}
+
+func TestSession_Immutable(t *testing.T) {
+	s := testRecord(t)
+	base := s.Where("Age > ?", 10)
+	if _, err := s.Insert(u2); err != nil {
+		t.Fatal("failed to insert", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			var users []User
+			if err := base.Sort("-age").Limit(0, 1).Find(&users); err != nil || len(users) != 1 || users[0].Name != "Jerry" {
+				errs <- fmt.Errorf("failed to find the oldest user, users: %v, err: %v", users, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if count, err := base.Count(); err != nil || count != 2 {
+				errs <- fmt.Errorf("expect 2 users older than 10, but got %d, err: %v", count, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// the base session is not changed by the chained ones
+	if count, err := s.Count(); err != nil || count != 3 {
+		t.Fatalf("expect 3 users without condition, but got %d, err: %v", count, err)
+	}
+
+	// the config setters return copies too
+	logger, slow := s.logger, s.slowThreshold
+	if configured := s.Logger(ormlog.Default).SlowThreshold(time.Hour).Cache(nil).Replicas(nil); configured == s ||
+		s.logger != logger || s.slowThreshold != slow || configured.slowThreshold != time.Hour {
+		t.Fatal("failed to keep the base session unchanged by the config setters")
+	}
+}
+
+func TestSession_OrderBy(t *testing.T) {
+	s := testRecord(t)
+	var users []User
+	if err := s.OrderBy(clause.OrderBy{Column: "Age", Desc: true}).Find(&users); err != nil ||
+		len(users) != 2 || users[0].Name != "Jerry" {
+		t.Fatalf("failed to order by age desc, users: %v, err: %v", users, err)
+	}
+	users = nil
+	if err := s.Sort("name").Find(&users); err != nil || len(users) != 2 || users[0].Name != "Jerry" {
+		t.Fatalf("failed to sort by name, users: %v, err: %v", users, err)
+	}
+	users = nil
+	if err := s.Sort("").Find(&users); err != nil || len(users) != 2 {
+		t.Fatalf("the empty sort should find all users unordered, users: %v, err: %v", users, err)
+	}
+	users = nil
+	if err := s.OrderBy().Find(&users); err != nil || len(users) != 2 {
+		t.Fatalf("OrderBy without columns should find all users unordered, users: %v, err: %v", users, err)
+	}
+	if err := s.Sort("-age; DROP TABLE User").Find(&users); err == nil {
+		t.Fatal("expect error for the column not in model")
+	}
+	if err := s.OrderByRaw("Age ASC").Sort("Password").Find(&users); err == nil {
+		t.Fatal("expect error for the column not in model, the last ORDERBY takes effect")
+	}
+	users = nil
+	if err := s.Sort("Password").OrderByRaw("length(Name) DESC").Find(&users); err != nil || users[0].Name != "Jerry" {
+		t.Fatalf("failed to order by raw desc, users: %v, err: %v", users, err)
+	}
+
+	// the last ORDERBY in the chain takes effect, and the empty one means no order
+	for _, c := range []struct {
+		s      *Session
+		expect string
+	}{
+		{s.OrderByRaw("length(Name) DESC").Sort("age"), `SELECT "Id","Name","Age","PrivateSecret" FROM "User" ORDER BY "Age" ASC`},
+		{s.Sort("age").OrderByRaw("length(Name) DESC"), `SELECT "Id","Name","Age","PrivateSecret" FROM "User" ORDER BY length(Name) DESC`},
+		{s.Sort("age").OrderBy(), `SELECT "Id","Name","Age","PrivateSecret" FROM "User"`},
+		{s.OrderByRaw("Age DESC").OrderBy(), `SELECT "Id","Name","Age","PrivateSecret" FROM "User"`},
+		{s.OrderByRaw("Age DESC").Sort(""), `SELECT "Id","Name","Age","PrivateSecret" FROM "User"`},
+	} {
+		sql, err := c.s.ToSQL(func(s *Session) error {
+			return s.Find(&users)
+		})
+		if err != nil || sql != c.expect {
+			t.Fatalf("expect %q, got %q, err: %v", c.expect, sql, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"miniorm/ormlog"
+)
+
+// ReplicaPolicy decides which replica the read statement runs on
+type ReplicaPolicy int
+
+const (
+	RoundRobin ReplicaPolicy = iota // the replicas are used in turn
+	Random                          // a replica is picked at random
+)
+
+// Replicas are the read-only copies of the primary database, the read statements of session run on them
+type Replicas struct {
+	dbs    []*sql.DB
+	policy ReplicaPolicy
+	next   uint32
+}
+
+// NewReplicas returns the replicas of dbs picked by policy, dbs must not be empty
+func NewReplicas(dbs []*sql.DB, policy ReplicaPolicy) *Replicas {
+	return &Replicas{dbs: dbs, policy: policy}
+}
+
+// pick returns a replica by the policy, it is safe for concurrent use
+func (r *Replicas) pick() *sql.DB {
+	if r.policy == Random {
+		return r.dbs[rand.Intn(len(r.dbs))]
+	}
+	return r.dbs[(atomic.AddUint32(&r.next, 1)-1)%uint32(len(r.dbs))]
+}
+
+// Ping checks the connections of all the replicas
+func (r *Replicas) Ping(ctx context.Context) (err error) {
+	for i, db := range r.dbs {
+		if err = db.PingContext(ctx); err != nil {
+			return ormlog.New(fmt.Sprintf("failed to ping replica %d: %v", i, err))
+		}
+	}
+	return
+}
+
+// Close closes all the replicas
+func (r *Replicas) Close() (err error) {
+	for _, db := range r.dbs {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// Replicas returns a session whose read statements run on the replicas, like Find, First, Count and QueryRows
+//  the writes and transactions always run on the primary database
+func (s *Session) Replicas(replicas *Replicas) (session *Session) {
+	session = s.clone()
+	session.replicas = replicas
+	return
+}
+
+// Primary returns a session whose statements all run on the primary database, it is used to read the data just
+// written because of the replication lag, or to run a raw write statement by QueryRow and QueryRows, like
+// "INSERT ... RETURNING"
+func (s *Session) Primary() (session *Session) {
+	session = s.clone()
+	session.primary = true
+	return
+}
+
+// readDB returns the database to run the read statement on, it is a replica if possible
+func (s *Session) readDB() (db CommonDB, onPrimary bool) {
+	if s.tx != nil || s.primary || s.replicas == nil || len(s.replicas.dbs) == 0 {
+		return s.DB(), true
+	}
+	return s.replicas.pick(), false
+}
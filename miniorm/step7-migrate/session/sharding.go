@@ -0,0 +1,230 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"miniorm/clause"
+	"miniorm/ormlog"
+)
+
+// Sharding splits the table of a model into shards by the value of the shard key column, the shards are the
+// tables with suffix like "Order_1" in the same database, or the tables of the same name in DBs
+//  the statements of sharded table must name the shard key, by the WHERE condition like "UserId = ?" or the field
+//  of the record to write, otherwise they are rejected, except the Find of Scatter
+type Sharding struct {
+	Column    string                                       // the shard key column
+	Shards    int                                          // the number of shards, it is len(DBs) if DBs are given
+	ShardFunc func(key interface{}) (shard int, err error) // the shard of key, HashShard by default
+	DBs       []*sql.DB                                    // the databases of shards, nil means the table suffixes
+}
+
+// HashShard returns the shard of key in n shards by the FNV hash of its text
+func HashShard(key interface{}, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fmt.Sprint(key)))
+	return int(h.Sum32() % uint32(n))
+}
+
+func (sh *Sharding) shards() int {
+	if len(sh.DBs) > 0 {
+		return len(sh.DBs)
+	}
+	return sh.Shards
+}
+
+// TableName returns the table name of shard, like "Order_1", it is the table name itself if the shards are DBs
+func (sh *Sharding) TableName(table string, shard int) string {
+	if len(sh.DBs) > 0 {
+		return table
+	}
+	return fmt.Sprintf("%s_%d", table, shard)
+}
+
+// shardOf returns the shard of key, the pointer key is dereferenced
+func (sh *Sharding) shardOf(key interface{}) (shard int, err error) {
+	if v := reflect.ValueOf(key); v.Kind() == reflect.Ptr {
+		key = nil
+		if !v.IsNil() {
+			key = v.Elem().Interface()
+		}
+	}
+	if key == nil {
+		return 0, ormlog.New(fmt.Sprintf("the shard key %s is nil", sh.Column))
+	}
+	if sh.ShardFunc == nil {
+		return HashShard(key, sh.shards()), nil
+	}
+	return sh.ShardFunc(key)
+}
+
+// Shardings returns a session whose statements of the sharded tables run on their shards, the key is the table name of model
+func (s *Session) Shardings(shardings map[string]*Sharding) (session *Session) {
+	session = s.clone()
+	session.shardings = shardings
+	return
+}
+
+// Scatter returns a session whose Find runs on all shards and merges the results if the WHERE condition does not
+// name the shard key, the results are in the order of shards, so ORDER BY and LIMIT only apply within a shard
+func (s *Session) Scatter() (session *Session) {
+	session = s.clone()
+	session.scatter = true
+	return
+}
+
+// Shard returns a session running on the given shard of model, it is used to create the table of shard or to
+// query a shard without the shard key, like:
+//  s.Model(&Order{}).Shard(1).CreateTable()
+func (s *Session) Shard(shard int) (session *Session) {
+	sharding := s.sharding()
+	if sharding == nil {
+		session = s.clone()
+		if session.stmtErr == nil {
+			session.stmtErr = ormlog.New(fmt.Sprintf("table %s is not sharded", s.RefTableName()))
+		}
+		return
+	}
+	session, err := s.onShard(sharding, shard)
+	if err != nil {
+		session = s.clone()
+		if session.stmtErr == nil {
+			session.stmtErr = err
+		}
+	}
+	return
+}
+
+// sharding returns the sharding of the model in session, nil if the model is not sharded or the session has been
+// routed to a shard
+func (s *Session) sharding() *Sharding {
+	if s.routed || s.refTable == nil || s.shardings == nil {
+		return nil
+	}
+	return s.shardings[s.refTable.Name]
+}
+
+// onShard returns the session running on the given shard
+func (s *Session) onShard(sharding *Sharding, shard int) (session *Session, err error) {
+	if shard < 0 || shard >= sharding.shards() {
+		return nil, ormlog.New(fmt.Sprintf("shard %d out of range of table %s", shard, s.refTable.Name))
+	}
+	session = s.clone()
+	session.routed = true
+	if len(sharding.DBs) > 0 {
+		if s.tx != nil {
+			return nil, ormlog.New(fmt.Sprintf("can not run the statement of table %s in transaction, "+
+				"its shards are in different databases", s.refTable.Name))
+		}
+		// the statements and replicas belong to the primary database
+		session.db, session.conn, session.stmts, session.replicas = sharding.DBs[shard], nil, nil, nil
+		// the tables of shards have the same name, keep their results out of the cache
+		session.noCache = true
+		return
+	}
+	table := *s.refTable
+	table.Name = sharding.TableName(table.Name, shard)
+	session.refTable = &table
+	return
+}
+
+// routeByWhere routes the session to the shard of the key in WHERE condition, it returns s if the model is not
+// sharded
+func (s *Session) routeByWhere() (session *Session, err error) {
+	sharding := s.sharding()
+	if sharding == nil {
+		return s, nil
+	}
+	key, ok := s.whereKey(sharding.Column)
+	if !ok {
+		return nil, ormlog.New(fmt.Sprintf("the WHERE condition on table %s must name the shard key like \"%s = ?\"",
+			s.refTable.Name, sharding.Column))
+	}
+	shard, err := sharding.shardOf(key)
+	if err != nil {
+		return
+	}
+	return s.onShard(sharding, shard)
+}
+
+// routeByRecord routes the session to the shard of the key in the record, it returns s if the model is not sharded
+func (s *Session) routeByRecord(value interface{}) (session *Session, err error) {
+	sharding := s.sharding()
+	if sharding == nil {
+		return s, nil
+	}
+	shard, err := s.shardOfRecord(sharding, value)
+	if err != nil {
+		return
+	}
+	return s.onShard(sharding, shard)
+}
+
+func (s *Session) shardOfRecord(sharding *Sharding, value interface{}) (shard int, err error) {
+	field := s.refTable.GetField(sharding.Column)
+	if field == nil {
+		return 0, ormlog.New(fmt.Sprintf("the shard key %s is not a column of table %s", sharding.Column, s.refTable.Name))
+	}
+	return sharding.shardOf(reflect.Indirect(reflect.ValueOf(value)).FieldByIndex(field.Index).Interface())
+}
+
+var orPattern = regexp.MustCompile(`(?i)\bOR\b`)
+
+// keyPatterns caches the compiled patterns of the equal conditions on shard keys, the patterns are compiled once
+// per shard key column
+var keyPatterns sync.Map // keyPatternKey -> *regexp.Regexp
+
+type keyPatternKey struct {
+	column string
+	quoted string
+}
+
+// keyPattern returns the pattern of the equal condition on column, named as it is or quoted
+func keyPattern(column, quoted string) *regexp.Regexp {
+	key := keyPatternKey{column: column, quoted: quoted}
+	if cached, ok := keyPatterns.Load(key); ok {
+		return cached.(*regexp.Regexp)
+	}
+	pattern := regexp.MustCompile(`(?i)(^|[^\w.])` + regexp.QuoteMeta(quoted) + `\s*=\s*\?|(^|[^\w."` + "`" +
+		`])` + regexp.QuoteMeta(column) + `\s*=\s*\?`)
+	cached, _ := keyPatterns.LoadOrStore(key, pattern)
+	return cached.(*regexp.Regexp)
+}
+
+// whereKey finds the value of the equal condition on column in WHERE clause, like "UserId = ?" or
+// "Age > ? AND "UserId" = ?", the condition with OR is never routed because it may match the rows of other shards
+func (s *Session) whereKey(column string) (key interface{}, ok bool) {
+	where, vars, ok := s.clause.Get(clause.WHERE)
+	if !ok || orPattern.MatchString(where) {
+		return nil, false
+	}
+	loc := keyPattern(column, s.Quote(column)).FindStringIndex(where)
+	if loc == nil {
+		return nil, false
+	}
+	// the key is the var of the last placeholder in the matched condition
+	index := strings.Count(where[:loc[1]], "?") - 1
+	if index >= len(vars) {
+		return nil, false
+	}
+	return vars[index], true
+}
+
+// scatterFind runs the query on all shards and appends the records of them to dstSlc in the order of shards
+func (s *Session) scatterFind(sharding *Sharding, dstSlc reflect.Value) (err error) {
+	for i := 0; i < sharding.shards(); i++ {
+		shard, err := s.onShard(sharding, i)
+		if err != nil {
+			return err
+		}
+		if err = shard.find(dstSlc); err != nil {
+			return err
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"testing"
+)
+
+type Order struct {
+	Id     int `miniorm:"PRIMARY KEY"`
+	UserId int
+	Amount int
+}
+
+func testSharding(t *testing.T) (s *Session) {
+	t.Helper()
+	sharding := &Sharding{Column: "UserId", Shards: 2, ShardFunc: func(key interface{}) (int, error) {
+		return key.(int) % 2, nil
+	}}
+	s = NewSession("sqlite3").Shardings(map[string]*Sharding{"Order": sharding}).Model(&Order{})
+	for i := 0; i < 2; i++ {
+		if err1, err2 := s.Shard(i).DropTable(), s.Shard(i).CreateTable(); err1 != nil || err2 != nil {
+			t.Fatalf("failed to create shard %d, drop-table-err: %v, create-table-err: %v", i, err1, err2)
+		}
+	}
+	return
+}
+
+func TestSession_Sharding(t *testing.T) {
+	s := testSharding(t)
+	if _, err := s.Insert(&Order{1, 1, 10}, &Order{2, 1, 20}); err != nil {
+		t.Fatal("failed to insert orders", err)
+	}
+	if _, err := s.Insert(&Order{3, 2, 30}); err != nil {
+		t.Fatal("failed to insert order", err)
+	}
+	if _, err := s.Insert(&Order{4, 1, 40}, &Order{5, 2, 50}); err == nil {
+		t.Fatal("expect error when the records are in different shards")
+	}
+
+	if count, err := s.Shard(1).Count(); err != nil || count != 2 {
+		t.Fatalf("the orders of user 1 should be in Order_1, count: %d, err: %v", count, err)
+	}
+	var orders []Order
+	if err := s.Where("Amount > ? AND UserId = ?", 0, 1).Find(&orders); err != nil || len(orders) != 2 {
+		t.Fatalf("failed to find orders by shard key, orders: %v, err: %v", orders, err)
+	}
+	if _, err := s.Where("Amount > ?", 0).Count(); err == nil {
+		t.Fatal("expect error when the shard key is not given")
+	}
+	if _, err := s.Where("UserId = ? OR Amount > ?", 1, 0).Delete(); err == nil {
+		t.Fatal("expect error when the shard key is in OR condition")
+	}
+
+	orders = nil
+	if err := s.Scatter().Where("Amount >= ?", 20).Find(&orders); err != nil || len(orders) != 2 {
+		t.Fatalf("failed to find orders on all shards, orders: %v, err: %v", orders, err)
+	}
+	if _, err := s.Where("UserId = ?", 2).Update("Amount", 31); err != nil {
+		t.Fatal("failed to update by shard key", err)
+	}
+	if _, err := s.UpdateRecord(&Order{1, 1, 11}); err != nil {
+		t.Fatal("failed to update record", err)
+	}
+	if _, err := s.DeleteRecord(&Order{2, 1, 20}); err != nil {
+		t.Fatal("failed to delete record", err)
+	}
+	orders = nil
+	if err := s.Scatter().Find(&orders); err != nil || len(orders) != 2 || orders[0] != (Order{3, 2, 31}) ||
+		orders[1] != (Order{1, 1, 11}) {
+		t.Fatalf("the writes should run on the shards, orders: %v, err: %v", orders, err)
+	}
+	if keyPattern("UserId", s.Quote("UserId")) != keyPattern("UserId", s.Quote("UserId")) {
+		t.Fatal("the pattern of shard key should be compiled once")
+	}
+}
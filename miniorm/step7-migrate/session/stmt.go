@@ -0,0 +1,122 @@
+package session
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// StmtCache is a LRU cache of the prepared statements keyed by sql, it is safe for concurrent use and usually
+// shared by the sessions of engine
+//  the evicted statement is closed after the sessions using it finish, the rows queried by it are not affected
+type StmtCache struct {
+	mu       sync.Mutex
+	db       *sql.DB
+	capacity int
+	ll       *list.List               // the front is the most recently used
+	items    map[string]*list.Element // sql -> element of *stmtEntry
+	hits     uint64
+	misses   uint64
+}
+
+type stmtEntry struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int  // the number of sessions using the statement
+	evicted bool // the statement is removed from cache, it is closed when refs becomes 0
+}
+
+// StmtCacheStats is the statistics of StmtCache
+type StmtCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int // the number of cached statements
+}
+
+// NewStmtCache returns a StmtCache holding at most capacity statements of db
+func NewStmtCache(db *sql.DB, capacity int) *StmtCache {
+	return &StmtCache{db: db, capacity: capacity, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the prepared statement of query, it is prepared on cache miss, the release must be called after
+// the statement is executed
+func (c *StmtCache) get(query string) (stmt *sql.Stmt, release func(), err error) {
+	if stmt, release, ok := c.cached(query); ok {
+		return stmt, release, nil
+	}
+
+	// prepare out of lock, the statement may be prepared by others at the same time
+	if stmt, err = c.db.Prepare(query); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[query]; ok {
+		_ = stmt.Close()
+		c.ll.MoveToFront(elem)
+		entry := elem.Value.(*stmtEntry)
+		entry.refs++
+		return entry.stmt, c.releaseFunc(entry), nil
+	}
+	entry := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.capacity {
+		c.evict(c.ll.Back())
+	}
+	return stmt, c.releaseFunc(entry), nil
+}
+
+// cached returns the prepared statement of query if it is cached, it is never prepared, ok is false on cache miss
+func (c *StmtCache) cached(query string) (stmt *sql.Stmt, release func(), ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[query]
+	if !ok {
+		c.misses++
+		return
+	}
+	c.hits++
+	c.ll.MoveToFront(elem)
+	entry := elem.Value.(*stmtEntry)
+	entry.refs++
+	return entry.stmt, c.releaseFunc(entry), true
+}
+
+func (c *StmtCache) releaseFunc(entry *stmtEntry) func() {
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		entry.refs--
+		if entry.evicted && entry.refs == 0 {
+			_ = entry.stmt.Close()
+		}
+	}
+}
+
+// evict removes the element from cache, it must be called with lock held
+func (c *StmtCache) evict(elem *list.Element) {
+	entry := elem.Value.(*stmtEntry)
+	c.ll.Remove(elem)
+	delete(c.items, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// Stats returns the hits, misses and size of cache
+func (c *StmtCache) Stats() StmtCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return StmtCacheStats{Hits: c.hits, Misses: c.misses, Size: c.ll.Len()}
+}
+
+// Close closes all the cached statements
+func (c *StmtCache) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll.Len() > 0 {
+		c.evict(c.ll.Back())
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	Init()
+	cache := NewStmtCache(TestDB, 2)
+	defer cache.Close()
+
+	stmt1, release1, err := cache.get("SELECT 1")
+	if err != nil {
+		t.Fatal("failed to prepare statement", err)
+	}
+	_, release2, _ := cache.get("SELECT 2")
+	release2()
+	_, release3, _ := cache.get("SELECT 1")
+	release3()
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 || stats.Size != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// "SELECT 2" is the least recently used one
+	_, release4, _ := cache.get("SELECT 3")
+	release4()
+	if _, ok := cache.items["SELECT 2"]; ok || cache.Stats().Size != 2 {
+		t.Fatal("failed to evict the least recently used statement")
+	}
+
+	// "SELECT 1" is evicted while it is in use, and it is closed after released
+	_, release5, _ := cache.get("SELECT 4")
+	release5()
+	if _, ok := cache.items["SELECT 1"]; ok {
+		t.Fatal("failed to evict the statement in use")
+	}
+	if _, err = stmt1.Exec(); err != nil {
+		t.Fatal("the evicted statement should not be closed before released", err)
+	}
+	release1()
+	if _, err = stmt1.Exec(); err == nil {
+		t.Fatal("the evicted statement should be closed after released")
+	}
+	if _, _, err = cache.get("SELECT x FROM"); err == nil {
+		t.Fatal("expect the error of preparing invalid sql")
+	}
+}
+
+func TestSession_StmtCache(t *testing.T) {
+	s := testRecord(t)
+	cache := NewStmtCache(TestDB, 10)
+	defer cache.Close()
+	s = s.StmtCache(cache)
+
+	for i := 0; i < 3; i++ {
+		if count, err := s.Where("Age > ?", 10).Count(); err != nil || count != 1 {
+			t.Fatalf("failed to count by prepared statement, count: %d, err: %v", count, err)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	_, err := s.Transaction(func(s *Session) (result interface{}, err error) {
+		if _, err = s.Insert(u2); err != nil {
+			return
+		}
+		var users []User
+		if err = s.Find(&users); err == nil && len(users) != 3 {
+			t.Fatalf("the prepared statement should run in transaction, users: %v", users)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal("failed to run transaction", err)
+	}
+}
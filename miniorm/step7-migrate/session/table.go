@@ -7,16 +7,22 @@ import (
 	"reflect"
 	"strings"
 
+	"miniorm/dialect"
 	"miniorm/ormlog"
 	"miniorm/schema"
 )
 
-// Model parses the given param 'v' to the dialect of Session
+// Model returns a session operating the table of the given param 'v', the schema is parsed once per struct type
+// and cached, the parse error is returned by RefTable
 func (s *Session) Model(v interface{}) (session *Session) {
-	if s.refTable == nil || reflect.TypeOf(v) != reflect.TypeOf(s.refTable.Model) {
-		s.refTable = schema.Parse(v, s.dialect)
+	session = s.clone()
+	if s.routed && v != nil && reflect.TypeOf(s.refTable.Model).Elem() == reflect.Indirect(reflect.ValueOf(v)).Type() {
+		// keep the table of the shard given by Shard
+		return
 	}
-	return s
+	session.routed = false
+	session.refTable, session.err = s.schemas.Parse(v, s.dialect, s.naming)
+	return
 }
 
 // RefTableName returns the table name in session, it returns "" if Session.refTable is nil
@@ -28,6 +34,9 @@ func (s *Session) RefTableName() (tableName string) {
 }
 
 func (s *Session) RefTable() (schema *schema.Schema, err error) {
+	if s.err != nil {
+		return nil, s.err
+	}
 	if s.refTable == nil {
 		return nil, ormlog.New("Model in session is not set")
 	}
@@ -39,18 +48,61 @@ func (s *Session) CreateTable() (err error) {
 	if err != nil {
 		return err
 	}
+	createSQL, err := s.CreateTableSQL(table.Name)
+	if err != nil {
+		return
+	}
+	if _, err = s.Raw(createSQL).Exec(); err != nil {
+		return
+	}
+	for _, index := range table.Indexes {
+		if _, err = s.Raw(s.CreateIndexSQL(index, table.Name)).Exec(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// CreateTableSQL returns the DDL to create the table of model in session with the given table name,
+// the table name can be different from the model`s, like the temporary table of migration
+func (s *Session) CreateTableSQL(tableName string) (createSQL string, err error) {
+	table, err := s.RefTable()
+	if err != nil {
+		return
+	}
 	var columns []string
 	for _, field := range table.Fields {
-		columns = append(columns, fmt.Sprintf("%s %s %s", field.Name, field.Type, field.Constraints))
+		columns = append(columns, fmt.Sprintf("%s %s %s", s.Quote(field.Name), field.Type, field.Constraints))
+	}
+	for _, fk := range table.ForeignKeys {
+		columns = append(columns, fk.QuotedSQL(s.Quote))
 	}
 	columnsDesc := strings.Join(columns, ",")
-	_, err = s.Raw(fmt.Sprintf("CREATE TABLE %s (%s);", table.Name, columnsDesc)).Exec()
+	return fmt.Sprintf("CREATE TABLE %s (%s);", s.Quote(tableName), columnsDesc), nil
+}
 
+// CreateIndexSQL returns the DDL to create the index on the table with the given table name
+func (s *Session) CreateIndexSQL(index *schema.Index, tableName string) (createSQL string) {
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	createSQL = fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)",
+		unique, s.Quote(index.Name), s.Quote(tableName), strings.Join(s.quoteAll(index.FieldNames()), ", "))
+	if index.Where != "" {
+		createSQL += " WHERE " + index.Where
+	}
 	return
 }
 
+// DropIndexSQL returns the DDL to drop the index with the given name
+func (s *Session) DropIndexSQL(indexName string) (dropSQL string) {
+	return fmt.Sprintf("DROP INDEX %s", s.Quote(indexName))
+}
+
 func (s *Session) DropTable() (err error) {
-	_, err = s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s;", s.RefTableName())).Exec()
+	_, err = s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s;", s.Quote(s.RefTableName()))).Exec()
 	return
 }
 
@@ -67,3 +119,13 @@ func (s *Session) TableExists() (exist bool, err error) {
 	}
 	return tableName == s.RefTableName(), nil
 }
+
+// ColumnTypes returns the metadata of columns of the table in database
+func (s *Session) ColumnTypes() (columns []dialect.ColumnType, err error) {
+	return s.dialect.ColumnTypes(s.DB(), s.RefTableName())
+}
+
+// Indexes returns the metadata of indexes of the table in database
+func (s *Session) Indexes() (indexes []dialect.Index, err error) {
+	return s.dialect.Indexes(s.DB(), s.RefTableName())
+}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"fmt"
 	"testing"
 
 	"miniorm/ormlog"
@@ -50,3 +51,90 @@ func Test_TableExists(t *testing.T) {
 		t.Fatalf("table '%s' is not exist", session.RefTableName())
 	}
 }
+
+type Purchase struct {
+	Id     int    `miniorm:"PRIMARY KEY"`
+	UserId int    `miniorm:"index:idx_purchase_user,priority:2"`
+	Status string `miniorm:"index:idx_purchase_user,priority:1"`
+	Code   string `miniorm:"uniqueIndex;index:idx_purchase_code_paid,where:Status = 'paid'"`
+}
+
+func TestSession_CreateTableIndexes(t *testing.T) {
+	s := NewSession("sqlite3").Model(&Purchase{})
+	if err := s.DropTable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := s.Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, index := range indexes {
+		found[index.Name] = fmt.Sprintf("%v %v %s", index.Unique, index.Columns, index.Where)
+	}
+	expected := map[string]string{
+		"idx_purchase_user":      "false [Status UserId] ",
+		"idx_Purchase_Code":      "true [Code] ",
+		"idx_purchase_code_paid": "false [Code] Status = 'paid'",
+	}
+	for name, desc := range expected {
+		if found[name] != desc {
+			t.Fatalf("failed to create index %s, expected: '%s', actual: '%s'", name, desc, found[name])
+		}
+	}
+}
+
+func TestSession_ModelError(t *testing.T) {
+	s := NewSession("sqlite3").Model(map[string]int{})
+	if _, err := s.RefTable(); err == nil {
+		t.Fatal("expect the parse error of model")
+	}
+	if err := s.CreateTable(); err == nil {
+		t.Fatal("expect the parse error of model")
+	}
+	if _, err := s.Model(&User{}).RefTable(); err != nil {
+		t.Fatal("failed to reset the parse error", err)
+	}
+}
+
+// Group and its columns are reserved words of sql
+type Group struct {
+	Id     int    `miniorm:"PRIMARY KEY"`
+	Order  int    `miniorm:"index"`
+	Select string `miniorm:"column:select value"`
+}
+
+func TestSession_QuoteIdentifiers(t *testing.T) {
+	s := NewSession("sqlite3").Model(&Group{})
+	if s.Quote(`my "table"`) != `"my ""table"""` {
+		t.Fatalf("failed to escape the quote marks, got %s", s.Quote(`my "table"`))
+	}
+	if s.Quote("Group.Order") != `"Group"."Order"` || s.Quote("Group.*") != `"Group".*` {
+		t.Fatalf("failed to quote the qualified column, got %s", s.Quote("Group.Order"))
+	}
+	if err1, err2 := s.DropTable(), s.CreateTable(); err1 != nil || err2 != nil {
+		t.Fatalf("failed to create table, drop-table-err: %v, create-table-err: %v", err1, err2)
+	}
+	if _, err := s.Insert(&Group{Id: 1, Order: 2, Select: "a"}); err != nil {
+		t.Fatal("failed to insert", err)
+	}
+	if _, err := s.Where(`"Order" = ?`, 2).Update("Select value", "b"); err != nil {
+		t.Fatal("failed to update", err)
+	}
+	if _, err := s.UpdateRecord(&Group{Id: 1, Order: 3, Select: "c"}); err != nil {
+		t.Fatal("failed to update record", err)
+	}
+	var groups []Group
+	if err := s.Find(&groups); err != nil || len(groups) != 1 || groups[0].Order != 3 || groups[0].Select != "c" {
+		t.Fatalf("failed to find groups: %v, err: %v", groups, err)
+	}
+	if count, err := s.Count(); err != nil || count != 1 {
+		t.Fatalf("failed to count groups: %d, err: %v", count, err)
+	}
+	if _, err := s.DeleteRecord(&groups[0]); err != nil {
+		t.Fatal("failed to delete record", err)
+	}
+}
@@ -1,27 +1,173 @@
 package session
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"miniorm/instrument"
 	"miniorm/ormlog"
 )
 
+// TxFunc is the callback of transaction, it includes all DB operation that makes up a transaction
+type TxFunc func(*Session) (interface{}, error)
+
 func (s *Session) Begin() (err error) {
-	ormlog.Info("transaction begin")
-	s.tx, err = s.db.Begin()
+	return s.BeginTx(context.Background(), nil)
+}
+
+// BeginTx begins a transaction with the options like isolation level and read-only,
+// the transaction is rolled back by database/sql if the ctx is done before it is committed
+func (s *Session) BeginTx(ctx context.Context, opts *sql.TxOptions) (err error) {
+	if s.tx != nil {
+		return ormlog.New("transaction has already begun in session")
+	}
+	s.logger.Infof("transaction begin")
+	s.txWrites = make(map[string]struct{})
+	s.txEvent = &instrument.Event{Operation: instrument.Transaction, Start: time.Now()}
+	if s.instrumentation != nil {
+		s.instrumentation.Start(s.txEvent)
+	}
+	if s.conn != nil {
+		s.tx, err = s.conn.BeginTx(ctx, opts)
+	} else {
+		s.tx, err = s.db.BeginTx(ctx, opts)
+	}
+	if err != nil {
+		// the transaction fails to begin, it is finished as a rollback
+		s.finishTx(instrument.Rollback, err)
+	}
+	return
+}
+
+// finishTx finishes the instrumentation of transaction with the operation commit or rollback
+func (s *Session) finishTx(operation string, err error) {
+	event := s.txEvent
+	s.txEvent = nil
+	if s.instrumentation == nil || event == nil {
+		return
+	}
+	event.Operation, event.Duration, event.Err = operation, time.Since(event.Start), err
+	s.instrumentation.Finish(event)
+}
+
+// Conn returns a session whose transactions begin on the dedicated connection, it is used with the connection
+// settings like "PRAGMA foreign_keys" of sqlite3
+//  NOTES: the statements out of transaction still run on any connection of db
+func (s *Session) Conn(conn *sql.Conn) (session *Session) {
+	session = s.clone()
+	session.conn = conn
 	return
 }
 
 func (s *Session) Commit() (err error) {
+	if s.tx == nil {
+		return ormlog.New("no transaction in session to commit")
+	}
 	err = s.tx.Commit()
+	s.tx = nil
+	s.finishTx(instrument.Commit, err)
 	if err == nil {
-		ormlog.Info("transaction commit")
+		s.logger.Infof("transaction commit")
+		for table := range s.txWrites {
+			s.invalidate(table)
+		}
 	}
+	s.txWrites = nil
 	return
 }
 
 func (s *Session) Rollback() (err error) {
+	if s.tx == nil {
+		return ormlog.New("no transaction in session to rollback")
+	}
 	err = s.tx.Rollback()
+	s.tx = nil
+	s.finishTx(instrument.Rollback, err)
+	s.txWrites = nil
 	if err == nil {
-		ormlog.Info("transaction rollback")
+		s.logger.Infof("transaction rollback")
 	}
 	return
 }
+
+// SavePoint creates a savepoint with the given name in the transaction
+func (s *Session) SavePoint(name string) (err error) {
+	if s.tx == nil {
+		return ormlog.New("no transaction in session to create savepoint")
+	}
+	_, err = s.Raw("SAVEPOINT " + name).Exec()
+	return
+}
+
+// RollbackTo rolls back the transaction to the savepoint with the given name
+func (s *Session) RollbackTo(name string) (err error) {
+	if s.tx == nil {
+		return ormlog.New("no transaction in session to rollback to savepoint")
+	}
+	_, err = s.Raw("ROLLBACK TO SAVEPOINT " + name).Exec()
+	return
+}
+
+// ReleaseSavePoint releases the savepoint with the given name, the changes after it are kept in the transaction
+func (s *Session) ReleaseSavePoint(name string) (err error) {
+	if s.tx == nil {
+		return ormlog.New("no transaction in session to release savepoint")
+	}
+	_, err = s.Raw("RELEASE SAVEPOINT " + name).Exec()
+	return
+}
+
+// InTransaction reports whether the session is in a transaction
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// Transaction runs f in a transaction, it commits if f returns nil error, otherwise it rollbacks
+//  the transaction begins on a copy of session passed to f, so s and the other sessions sharing it are not in
+//  the transaction
+//  if the session is already in a transaction, f runs in a savepoint of it, and a failed f only rollbacks
+//  to the savepoint, so that the outer transaction is not aborted and can decide what to do by itself
+func (s *Session) Transaction(f TxFunc) (result interface{}, err error) {
+	return s.TransactionTx(context.Background(), nil, f)
+}
+
+// TransactionTx is the same as Transaction, but the transaction begins with the given ctx and opts
+//  the ctx and opts are ignored if the session is already in a transaction
+func (s *Session) TransactionTx(ctx context.Context, opts *sql.TxOptions, f TxFunc) (result interface{}, err error) {
+	tx := s.clone()
+	if tx.tx == nil {
+		if err = tx.BeginTx(ctx, opts); err != nil {
+			return
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				_ = tx.Rollback()
+				panic(p) // re-throw the panic after rollback
+			} else if err != nil {
+				_ = tx.Rollback() // err is not nil, just rollback
+			} else {
+				err = tx.Commit() // err is nil, commit and update err
+			}
+		}()
+		return f(tx)
+	}
+
+	tx.txDepth++
+	savepoint := fmt.Sprintf("sp_%d", tx.txDepth)
+	if err = tx.SavePoint(savepoint); err != nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.RollbackTo(savepoint)
+			panic(p)
+		} else if err != nil {
+			_ = tx.RollbackTo(savepoint)
+		} else {
+			err = tx.ReleaseSavePoint(savepoint)
+		}
+	}()
+	return f(tx)
+}
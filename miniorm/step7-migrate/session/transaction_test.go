@@ -0,0 +1,59 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSession_Transaction(t *testing.T) {
+	s := testRecord(t)
+	_, err := s.Transaction(func(tx *Session) (result interface{}, err error) {
+		// the transaction begins on a copy, the sessions sharing s are not pulled into it
+		if tx == s || s.InTransaction() || !tx.InTransaction() {
+			t.Fatal("the transaction should begin on a copy of session")
+		}
+		if _, err = tx.Insert(u2); err != nil {
+			return
+		}
+		// the failed inner scope only rollbacks to its savepoint
+		_, innerErr := tx.Transaction(func(tx *Session) (result interface{}, err error) {
+			if _, err = tx.Where("Name = ?", "Tom").Delete(); err != nil {
+				return
+			}
+			_, err = tx.Transaction(func(tx *Session) (interface{}, error) {
+				_, err := tx.Where("Name = ?", "Jerry").Delete()
+				return nil, err
+			})
+			if err != nil {
+				return
+			}
+			return nil, errors.New("fake error")
+		})
+		if innerErr == nil {
+			t.Fatal("failed to get the error of inner transaction")
+		}
+		return
+	})
+	if err != nil {
+		t.Fatalf("failed to commit the outer transaction, err: %v", err)
+	}
+	if s.InTransaction() {
+		t.Fatal("failed to end the transaction after commit")
+	}
+
+	count, err := s.Count()
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 users after the inner rollback, actual: %d, err: %v", count, err)
+	}
+}
+
+func TestSession_Begin(t *testing.T) {
+	s := NewSession("sqlite3")
+	if err := s.Begin(); err != nil {
+		t.Fatalf("failed to begin transaction, err: %v", err)
+	}
+	defer s.Rollback()
+	if err := s.Begin(); err == nil {
+		t.Fatal("expected error when begin a transaction twice")
+	}
+}